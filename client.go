@@ -3,26 +3,67 @@ package llmstructed
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"maps"
 	"net/http"
 	"reflect"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 )
 
 type Client interface {
-	Do(ctx context.Context, messages []string, ret any) error
+	// Do sends messages to the LLM as user messages and unmarshals the structured output into ret.
+	// ret must be a non-nil pointer, e.g. *struct, *[]Item, *map[string]T, *time.Time or *int.
+	Do(ctx context.Context, messages []string, ret any, opts ...CallOption) error
+	// DoMessages is like Do, but with role-aware messages,
+	// e.g. a custom system prompt, prior assistant turns or few-shot examples.
+	DoMessages(ctx context.Context, messages []Message, ret any, opts ...CallOption) error
+	// DoStream is like Do, but streams the response. Each time more of the result is generated,
+	// the partial result is decoded into ret and onUpdate is called, so it can be rendered early.
+	// Returning an error from onUpdate aborts the call. ret holds the complete result once DoStream returns nil.
+	DoStream(ctx context.Context, messages []string, ret any, onUpdate func() error, opts ...CallOption) error
+	// DoStreamMessages is like DoStream, but with role-aware messages.
+	DoStreamMessages(ctx context.Context, messages []Message, ret any, onUpdate func() error, opts ...CallOption) error
 
 	// Simple method for single value
-	String(ctx context.Context, messages []string) (string, error)
-	StringSlice(ctx context.Context, messages []string) ([]string, error)
-	Bool(ctx context.Context, messages []string) (bool, error)
-	BoolSlice(ctx context.Context, messages []string) ([]bool, error)
-	Int(ctx context.Context, messages []string) (int, error)
-	IntSlice(ctx context.Context, messages []string) ([]int, error)
-	Float(ctx context.Context, messages []string) (float32, error)
-	FloatSlice(ctx context.Context, messages []string) ([]float32, error)
+	String(ctx context.Context, messages []string, opts ...CallOption) (string, error)
+	StringSlice(ctx context.Context, messages []string, opts ...CallOption) ([]string, error)
+	Bool(ctx context.Context, messages []string, opts ...CallOption) (bool, error)
+	BoolSlice(ctx context.Context, messages []string, opts ...CallOption) ([]bool, error)
+	Int(ctx context.Context, messages []string, opts ...CallOption) (int, error)
+	IntSlice(ctx context.Context, messages []string, opts ...CallOption) ([]int, error)
+	Float(ctx context.Context, messages []string, opts ...CallOption) (float32, error)
+	FloatSlice(ctx context.Context, messages []string, opts ...CallOption) ([]float32, error)
+
+	// Stats returns the token usage and estimated cost accumulated over all calls.
+	Stats() Stats
+}
+
+// Role is the role of a chat message author.
+type Role string
+
+const (
+	RoleSystem    Role = "system"
+	RoleUser      Role = "user"
+	RoleAssistant Role = "assistant"
+)
+
+// Message is a single chat message.
+type Message struct {
+	Role    Role   `json:"role"`
+	Content string `json:"content"`
+}
+
+// UserMessages converts plain strings to user messages.
+func UserMessages(contents ...string) []Message {
+	messages := make([]Message, 0, len(contents))
+	for _, content := range contents {
+		messages = append(messages, Message{Role: RoleUser, Content: content})
+	}
+	return messages
 }
 
 // Config contains the configuration options for the LLM client.
@@ -42,24 +83,75 @@ type Config struct {
 	Model string
 	// Temperature controls randomness in the model's output (0.0-2.0)
 	// Recommended to use lower values for stable structured output, especially when Model doesn't support structured output
+	// Not sent to reasoning models, such as deepseek-reasoner and OpenAI o-series, which reject it,
+	// nor when ReasoningEffort is set.
 	// Default: 0.0
 	Temperature float32
+	// ReasoningEffort controls how long reasoning models think before answering, e.g. "low", "medium" or "high".
+	// Their reasoning is reported by WithMetadata, and <think> blocks are stripped from the output.
+	// Default: "", the default of the model
+	ReasoningEffort string
 	// StructuredOutputSupported indicates whether the model supports structured output,
 	// else the output structure is not guaranteed, especially for some low-quality models.
 	// But if you not sure, MUST set it to false.
 	// See https://platform.openai.com/docs/guides/structured-outputs
 	// Default: false
 	StructuredOutputSupported bool
+	// PropertyOrderingSupported adds the propertyOrdering keyword to the response schema of structured output,
+	// for Gemini, which otherwise doesn't generate properties in the order of the schema.
+	// Properties are generated in struct field declaration order, or the order given by order tags.
+	// Default: false
+	PropertyOrderingSupported bool
+	// SystemPrompt is the system message prepended to every request without one.
+	// SchemaPlaceholder in it is replaced by the JSON Schema of the response.
+	// Default: "You are a helpful assistant that provides structured output. Your response must be a valid JSON object."
+	SystemPrompt string
+	// SchemaPrompt instructs the model how to format its response when StructuredOutputSupported=false.
+	// It must contain SchemaPlaceholder, which is replaced by the JSON Schema of the response.
+	// Default: "You must format your response as a JSON object following this schema: \n{{schema}}\nDo not include any other text in your response."
+	SchemaPrompt string
 	// Retry specifies how many times to retry failed requests.
 	// When StructuredOutputSupported=false, it's recommended to enable retry.
 	// Default: 0
 	Retry int
+	// RetryPolicy controls the backoff between retries.
+	// Requests failed with non-retryable errors, such as 401 or a canceled context, are never retried.
+	// See RetryPolicy for the defaults.
+	RetryPolicy RetryPolicy
+	// Repair specifies how many times to ask the model to correct a response that doesn't match the schema
+	// or cannot be unmarshalled, by sending back its invalid output together with the error. Repair rounds don't consume Retry.
+	// Recommended for weak models, which tend to fail the same way when the identical request is resent.
+	// Default: 0
+	Repair int
+	// ChainOfThought asks the model to reason step by step before answering, which improves the results
+	// of weak models a lot, by prepending a hidden property to the response schema. The reasoning is
+	// stripped from the result, and reported by WithMetadata.
+	// Default: false
+	ChainOfThought bool
+	// Validate is called on every struct result, e.g. *Summary but not *[]Summary or *string,
+	// after the Validate methods of the result and its nested values, see Validator. An error is fed back to the model like a response not matching the schema.
+	// E.g. validator.New().Struct of github.com/go-playground/validator to support its validate tags.
+	// Default: nil
+	Validate func(ret any) error
+	// Prices maps model names to their prices, used to estimate the cost reported by
+	// WithMetadata and Client.Stats. Models not in the map are considered free.
+	// Default: nil
+	Prices map[string]Price
 }
 
 type client struct {
-	llm         llm
-	retry       int
-	schemaCache sync.Map
+	llm              llm
+	structuredOutput bool
+	retry            int
+	retryPolicy      RetryPolicy
+	repair           int
+	chainOfThought   bool
+	prices           map[string]Price
+	validate         func(ret any) error
+	schemaCache      sync.Map
+
+	statsMu sync.Mutex
+	stats   Stats
 }
 
 func New(config Config) (Client, error) {
@@ -69,6 +161,15 @@ func New(config Config) (Client, error) {
 	if config.Temperature < 0 || config.Temperature > 2 {
 		return nil, errors.New("temperature must be between 0 and 2")
 	}
+	if config.Retry < 0 || config.Repair < 0 {
+		return nil, errors.New("retry and repair must not be negative")
+	}
+	if err := config.RetryPolicy.validate(); err != nil {
+		return nil, err
+	}
+	if config.SchemaPrompt != "" && !strings.Contains(config.SchemaPrompt, SchemaPlaceholder) {
+		return nil, errors.Errorf("schema prompt must contain %s", SchemaPlaceholder)
+	}
 	if config.BaseURL == "" {
 		config.BaseURL = "https://api.deepseek.com/v1"
 	}
@@ -83,221 +184,357 @@ func New(config Config) (Client, error) {
 			APIKey:                    config.APIKey,
 			Model:                     config.Model,
 			Temperature:               config.Temperature,
+			ReasoningEffort:           config.ReasoningEffort,
 			StructuredOutputSupported: config.StructuredOutputSupported,
+			PropertyOrderingSupported: config.PropertyOrderingSupported,
+			SystemPrompt:              config.SystemPrompt,
+			SchemaPrompt:              config.SchemaPrompt,
 		},
 		hc: &http.Client{},
 	}
 
 	return &client{
-		llm:   llm,
-		retry: config.Retry,
+		llm:              llm,
+		structuredOutput: config.StructuredOutputSupported,
+		retry:            config.Retry,
+		retryPolicy:      config.RetryPolicy.withDefaults(),
+		repair:           config.Repair,
+		chainOfThought:   config.ChainOfThought,
+		prices:           config.Prices,
+		validate:         config.Validate,
 	}, nil
 }
 
-func typeToSchema(t reflect.Type) (*schema, error) {
-	for t.Kind() == reflect.Ptr {
-		t = t.Elem()
-	}
-
-	switch t.Kind() {
-	case reflect.String:
-		return &schema{Type: schemaTypeString}, nil
-	case reflect.Float32, reflect.Float64:
-		return &schema{Type: schemaTypeNumber}, nil
-	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
-		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-		return &schema{Type: schemaTypeInteger}, nil
-	case reflect.Bool:
-		return &schema{Type: schemaTypeBoolean}, nil
-	case reflect.Slice, reflect.Array:
-		s, err := typeToSchema(t.Elem())
-		if err != nil {
-			return nil, err
-		}
-		return &schema{
-			Type:       schemaTypeArray,
-			ArrayItems: s,
-		}, nil
-	case reflect.Struct:
-		properties := make(map[string]*schema)
-		for i := 0; i < t.NumField(); i++ {
-			field := t.Field(i)
-			if field.PkgPath != "" {
-				continue
-			}
-			jsonTag := field.Tag.Get("json")
-			if jsonTag == "-" {
-				continue
-			}
+// Get is a type-safe shortcut for Client.Do.
+// The result type is checked at compile time, e.g.
+//
+//	summary, err := llmstructed.Get[Summary](ctx, cli, messages)
+func Get[T any](ctx context.Context, cli Client, messages []string, opts ...CallOption) (T, error) {
+	return GetMessages[T](ctx, cli, UserMessages(messages...), opts...)
+}
 
-			name := field.Name
-			if jsonTag != "" {
-				if comma := strings.Index(jsonTag, ","); comma != -1 {
-					name = jsonTag[:comma]
-				} else {
-					name = jsonTag
-				}
-			}
-			s, err := typeToSchema(field.Type)
-			if err != nil {
-				return nil, err
-			}
-			s.Description = field.Tag.Get("desc")
-			if s.Type == schemaTypeString {
-				if enumTag := field.Tag.Get("enum"); enumTag != "" {
-					s.Enum = strings.Split(enumTag, ",")
-				}
-			}
-			properties[name] = s
+// GetMessages is a type-safe shortcut for Client.DoMessages.
+func GetMessages[T any](ctx context.Context, cli Client, messages []Message, opts ...CallOption) (T, error) {
+	var ret T
+	if err := cli.DoMessages(ctx, messages, &ret, opts...); err != nil {
+		var zero T
+		return zero, err
+	}
+	return ret, nil
+}
+
+const repairPrompt = "Your previous response is invalid: %s\nPlease correct it and respond with only the fixed JSON object."
+
+func repairMessages(messages []Message, invalid []byte, err error) []Message {
+	// Full slice expression to never overwrite the caller's backing array
+	return append(messages[:len(messages):len(messages)],
+		Message{Role: RoleAssistant, Content: string(invalid)},
+		Message{Role: RoleUser, Content: fmt.Sprintf(repairPrompt, err)},
+	)
+}
+
+// envelope wraps non-object results, since the response must be a JSON object.
+type envelope struct {
+	schema *schema
+	// key is the property holding the actual result, empty if ret is not wrapped.
+	key string
+	// chainOfThought is the property holding the reasoning of the model, empty if not asked for.
+	chainOfThought string
+	// normalize reports whether the response must be normalized before decoding, see normalize.
+	normalize bool
+}
+
+type envelopeKey struct {
+	t              reflect.Type
+	chainOfThought bool
+}
+
+const chainOfThoughtDescription = "Think step by step about the answer here, before filling in the other properties"
+
+func (c *client) responseSchema(t reflect.Type, chainOfThought bool) (*envelope, error) {
+	cacheKey := envelopeKey{t: t, chainOfThought: chainOfThought}
+	if cached, ok := c.schemaCache.Load(cacheKey); ok {
+		return cached.(*envelope), nil
+	}
+
+	sche, err := typeToSchema(t)
+	if err != nil {
+		return nil, err
+	}
+	env := &envelope{}
+	if c.structuredOutput {
+		// Converted before wrapping, since a map result becomes an array
+		sche, _ = mapsToKeyValuePairs(sche)
+	}
+	env.schema = sche
+	// Maps and fragments of a JSONSchemaProvider are wrapped too for the chain of thought,
+	// since it cannot be added to their properties
+	if sche.Type != schemaTypeObject || chainOfThought && (sche.MapValues != nil || sche.Raw != nil) {
+		env.key = "value"
+		if sche.Type == schemaTypeArray {
+			env.key = "values"
 		}
-		return &schema{
+		// Definitions must stay at the root
+		wrapped := *sche
+		wrapped.Defs = nil
+		env.schema = &schema{
 			Type:             schemaTypeObject,
-			ObjectProperties: properties,
-		}, nil
-	default:
-		return nil, errors.Errorf("unsupported type: %s", t.Kind())
+			ObjectProperties: map[string]*schema{env.key: &wrapped},
+			PropertyOrder:    []string{env.key},
+			Defs:             sche.Defs,
+		}
 	}
+	if chainOfThought {
+		// Prepended, so the model reasons before generating the result
+		env.chainOfThought = "chain_of_thought"
+		for env.schema.ObjectProperties[env.chainOfThought] != nil {
+			env.chainOfThought = "_" + env.chainOfThought
+		}
+		root := *env.schema
+		root.ObjectProperties = maps.Clone(root.ObjectProperties)
+		root.ObjectProperties[env.chainOfThought] = &schema{Type: schemaTypeString, Description: chainOfThoughtDescription}
+		root.PropertyOrder = append([]string{env.chainOfThought}, propertyNames(env.schema)...)
+		env.schema = &root
+	}
+	env.normalize = needsNormalize(env.schema)
+	c.schemaCache.Store(cacheKey, env)
+	return env, nil
 }
 
-func (c *client) Do(ctx context.Context, messages []string, ret any) error {
-	v := reflect.ValueOf(ret)
-	if v.Kind() != reflect.Ptr {
-		return errors.New("ret must be a pointer")
+// path returns the JSON path of the result in the response.
+func (e *envelope) path() string {
+	if e.key == "" {
+		return "$"
 	}
+	return "$." + e.key
+}
 
-	t := v.Elem().Type()
-	if t.Kind() != reflect.Struct {
-		return errors.Errorf("ret must be a pointer to struct, got %s", t.Kind())
+// reasoning returns the chain of thought in the response, empty if none.
+func (e *envelope) reasoning(data []byte) string {
+	if e.chainOfThought == "" {
+		return ""
 	}
+	var response map[string]json.RawMessage
+	if err := json.Unmarshal(data, &response); err != nil {
+		return ""
+	}
+	var reasoning string
+	_ = json.Unmarshal(response[e.chainOfThought], &reasoning)
+	return reasoning
+}
 
-	var sche *schema
-	if cached, ok := c.schemaCache.Load(t); ok {
-		sche = cached.(*schema)
-	} else {
-		schema, err := typeToSchema(t)
-		if err != nil {
+func (e *envelope) unmarshal(data []byte, ret any) error {
+	if e.normalize {
+		var err error
+		if data, err = normalize(data, e.schema); err != nil {
 			return err
 		}
-		sche = schema
-		c.schemaCache.Store(t, schema)
 	}
-
-	var lastErr error
-	retries := c.retry
-	if retries <= 0 {
-		retries = 1
+	if e.key == "" {
+		return json.Unmarshal(data, ret)
 	}
 
-	for i := 0; i < retries+1; i++ {
-		respBytes, err := c.llm.Completions(ctx, messages, sche)
-		if err != nil {
-			lastErr = err
-			continue
-		}
-
-		if err := json.Unmarshal(respBytes, ret); err != nil {
-			lastErr = errors.Wrapf(err, "unmarshal response: %s", string(respBytes))
-			continue
+	var wrapped map[string]json.RawMessage
+	if err := json.Unmarshal(data, &wrapped); err != nil {
+		return err
+	}
+	for k, value := range wrapped {
+		// Match keys case-insensitively, the same as encoding/json does for struct fields.
+		if strings.EqualFold(k, e.key) {
+			return json.Unmarshal(value, ret)
 		}
-
-		return nil
 	}
-
-	return lastErr
+	return errors.Errorf("missing %q in response", e.key)
 }
 
-type stringResponse struct {
-	Value string
+func (c *client) Do(ctx context.Context, messages []string, ret any, opts ...CallOption) error {
+	return c.DoMessages(ctx, UserMessages(messages...), ret, opts...)
 }
 
-func (c *client) String(ctx context.Context, messages []string) (string, error) {
-	var resp stringResponse
-	if err := c.Do(ctx, messages, &resp); err != nil {
-		return "", err
-	}
-	return resp.Value, nil
+func (c *client) DoMessages(ctx context.Context, messages []Message, ret any, opts ...CallOption) error {
+	return c.do(ctx, messages, ret, nil, opts)
 }
 
-type stringSliceResponse struct {
-	Values []string
+func (c *client) DoStream(ctx context.Context, messages []string, ret any, onUpdate func() error, opts ...CallOption) error {
+	return c.DoStreamMessages(ctx, UserMessages(messages...), ret, onUpdate, opts...)
 }
 
-func (c *client) StringSlice(ctx context.Context, messages []string) ([]string, error) {
-	var resp stringSliceResponse
-	if err := c.Do(ctx, messages, &resp); err != nil {
-		return nil, err
+func (c *client) DoStreamMessages(ctx context.Context, messages []Message, ret any, onUpdate func() error, opts ...CallOption) error {
+	if onUpdate == nil {
+		return errors.New("onUpdate must not be nil")
 	}
-	return resp.Values, nil
+	return c.do(ctx, messages, ret, onUpdate, opts)
 }
 
-type boolResponse struct {
-	Value bool
-}
+// do sends the request and unmarshals the result into ret, with retries and repair rounds.
+// The response is streamed if onUpdate is not nil.
+func (c *client) do(ctx context.Context, messages []Message, ret any, onUpdate func() error, opts []CallOption) error {
+	options := newCallOptions(opts)
+	if options.schemaPrompt != "" && !strings.Contains(options.schemaPrompt, SchemaPlaceholder) {
+		return errors.Errorf("schema prompt must contain %s", SchemaPlaceholder)
+	}
+	if t := options.temperature; t != nil && (*t < 0 || *t > 2) {
+		return errors.New("temperature must be between 0 and 2")
+	}
+	if options.maxTokens < 0 {
+		return errors.New("max tokens must not be negative")
+	}
+	if options.repair != nil && *options.repair < 0 {
+		return errors.New("repair must not be negative")
+	}
+	for _, msg := range messages {
+		switch msg.Role {
+		case RoleSystem, RoleUser, RoleAssistant:
+		default:
+			return errors.Errorf("unsupported message role: %q", msg.Role)
+		}
+	}
+
+	v := reflect.ValueOf(ret)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return errors.New("ret must be a non-nil pointer")
+	}
+
+	chainOfThought := c.chainOfThought
+	if options.chainOfThought != nil {
+		chainOfThought = *options.chainOfThought
+	}
+	env, err := c.responseSchema(v.Elem().Type(), chainOfThought)
+	if err != nil {
+		return err
+	}
+
+	if options.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, options.timeout)
+		defer cancel()
+	}
+
+	md := options.metadata
+	if md == nil {
+		md = &Metadata{}
+	}
+	*md = Metadata{}
+	defer c.addStats(md)
+
+	var lastErr error
+	start := time.Now()
+	repairs := c.repair
+	if options.repair != nil {
+		repairs = *options.repair
+	}
 
-func (c *client) Bool(ctx context.Context, messages []string) (bool, error) {
-	var resp boolResponse
-	if err := c.Do(ctx, messages, &resp); err != nil {
-		return false, err
+	for attempt := 0; ; {
+		var resp *completion
+		switch {
+		case onUpdate == nil:
+			resp, err = c.llm.Completions(ctx, messages, env.schema, options)
+		case options.items != nil:
+			resp, err = c.llm.Stream(ctx, messages, env.schema, options, env.itemDecoder(v, options.items))
+		default:
+			resp, err = c.llm.Stream(ctx, messages, env.schema, options, env.partialDecoder(v, onUpdate))
+		}
+		md.add(resp, c.prices)
+		var cbErr callbackError
+		if errors.As(err, &cbErr) {
+			return cbErr.err
+		}
+		var decodeErr *DecodeError
+		if err == nil {
+			respBytes := resp.content
+			md.ChainOfThought = env.reasoning(respBytes)
+			if onUpdate != nil {
+				// Drop the last partial result
+				v.Elem().Set(reflect.Zero(v.Elem().Type()))
+			}
+			// Decode into a fresh value, so nothing is left over from a rejected attempt
+			fresh := reflect.New(v.Elem().Type())
+			if err = validate(respBytes, env.schema); err == nil {
+				err = env.unmarshal(respBytes, fresh.Interface())
+			}
+			if err == nil {
+				err = validateResult(fresh, env.path(), c.validate)
+			}
+			if err == nil {
+				v.Elem().Set(fresh.Elem())
+				return nil
+			}
+			decodeErr = &DecodeError{Content: string(respBytes), Type: v.Elem().Type(), Err: err}
+			err = decodeErr
+		}
+		if options.items != nil {
+			if abortErr := options.items.abort(err); abortErr != nil {
+				return abortErr
+			}
+		}
+		if decodeErr != nil && repairs > 0 {
+			// Feed the invalid output and the error back, so the model can correct itself
+			repairs--
+			messages = repairMessages(messages, []byte(decodeErr.Content), decodeErr.Err)
+			lastErr = err
+			continue
+		}
+		lastErr = err
+
+		attempt++
+		if attempt > c.retry || ctx.Err() != nil || !retryable(err) {
+			break
+		}
+		delay := c.retryPolicy.backoff(attempt, err)
+		if limit := c.retryPolicy.MaxElapsedTime; limit > 0 && time.Since(start)+delay > limit {
+			break
+		}
+		if err := sleep(ctx, delay); err != nil {
+			// Both are wrapped, so the failure of the last attempt can still be inspected
+			return fmt.Errorf("%w: %w", lastErr, err)
+		}
 	}
-	return resp.Value, nil
+
+	return lastErr
 }
 
-type boolSliceResponse struct {
-	Values []bool
+func (c *client) addStats(md *Metadata) {
+	c.statsMu.Lock()
+	defer c.statsMu.Unlock()
+	c.stats.Usage.add(md.Usage)
+	c.stats.Cost += md.Cost
+	c.stats.Requests += md.Requests
 }
 
-func (c *client) BoolSlice(ctx context.Context, messages []string) ([]bool, error) {
-	var resp boolSliceResponse
-	if err := c.Do(ctx, messages, &resp); err != nil {
-		return nil, err
-	}
-	return resp.Values, nil
+func (c *client) Stats() Stats {
+	c.statsMu.Lock()
+	defer c.statsMu.Unlock()
+	return c.stats
 }
 
-type intResponse struct {
-	Value int
+func (c *client) String(ctx context.Context, messages []string, opts ...CallOption) (string, error) {
+	return Get[string](ctx, c, messages, opts...)
 }
 
-func (c *client) Int(ctx context.Context, messages []string) (int, error) {
-	var resp intResponse
-	if err := c.Do(ctx, messages, &resp); err != nil {
-		return 0, err
-	}
-	return resp.Value, nil
+func (c *client) StringSlice(ctx context.Context, messages []string, opts ...CallOption) ([]string, error) {
+	return Get[[]string](ctx, c, messages, opts...)
 }
 
-type intSliceResponse struct {
-	Values []int
+func (c *client) Bool(ctx context.Context, messages []string, opts ...CallOption) (bool, error) {
+	return Get[bool](ctx, c, messages, opts...)
 }
 
-func (c *client) IntSlice(ctx context.Context, messages []string) ([]int, error) {
-	var resp intSliceResponse
-	if err := c.Do(ctx, messages, &resp); err != nil {
-		return nil, err
-	}
-	return resp.Values, nil
+func (c *client) BoolSlice(ctx context.Context, messages []string, opts ...CallOption) ([]bool, error) {
+	return Get[[]bool](ctx, c, messages, opts...)
 }
 
-type floatResponse struct {
-	Value float32
+func (c *client) Int(ctx context.Context, messages []string, opts ...CallOption) (int, error) {
+	return Get[int](ctx, c, messages, opts...)
 }
 
-func (c *client) Float(ctx context.Context, messages []string) (float32, error) {
-	var resp floatResponse
-	if err := c.Do(ctx, messages, &resp); err != nil {
-		return 0, err
-	}
-	return resp.Value, nil
+func (c *client) IntSlice(ctx context.Context, messages []string, opts ...CallOption) ([]int, error) {
+	return Get[[]int](ctx, c, messages, opts...)
 }
 
-type floatSliceResponse struct {
-	Values []float32
+func (c *client) Float(ctx context.Context, messages []string, opts ...CallOption) (float32, error) {
+	return Get[float32](ctx, c, messages, opts...)
 }
 
-func (c *client) FloatSlice(ctx context.Context, messages []string) ([]float32, error) {
-	var resp floatSliceResponse
-	if err := c.Do(ctx, messages, &resp); err != nil {
-		return nil, err
-	}
-	return resp.Values, nil
+func (c *client) FloatSlice(ctx context.Context, messages []string, opts ...CallOption) ([]float32, error) {
+	return Get[[]float32](ctx, c, messages, opts...)
 }
@@ -2,8 +2,13 @@ package llmstructed
 
 import (
 	"context"
+	"encoding/json"
+	"math"
+	"net/http"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/pkg/errors"
 )
@@ -43,6 +48,22 @@ func TestNew(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "schema prompt without placeholder",
+			config: Config{
+				APIKey:       "test-key",
+				SchemaPrompt: "Output JSON",
+			},
+			wantErr: true,
+		},
+		{
+			name: "negative repair",
+			config: Config{
+				APIKey: "test-key",
+				Repair: -1,
+			},
+			wantErr: true,
+		},
 		{
 			name: "default values",
 			config: Config{
@@ -145,6 +166,180 @@ func TestTypeToSchema(t *testing.T) {
 	}
 }
 
+func TestTypeToSchemaOptional(t *testing.T) {
+	type Person struct {
+		Name     string  `json:"name"`
+		Nickname *string `json:"nickname"`
+		Age      int     `json:"age,omitempty"`
+		Email    string  `json:",omitempty"`
+	}
+
+	s, err := typeToSchema(reflect.TypeOf(Person{}))
+	if err != nil {
+		t.Fatalf("typeToSchema() error = %v", err)
+	}
+	for name, want := range map[string]bool{"name": false, "nickname": true, "age": true, "Email": true} {
+		prop, ok := s.ObjectProperties[name]
+		if !ok {
+			t.Errorf("missing field %s in schema", name)
+			continue
+		}
+		if prop.Optional != want {
+			t.Errorf("field %s optional = %v, want %v", name, prop.Optional, want)
+		}
+	}
+
+	c := &client{structuredOutput: true, llm: &mockLLM{
+		responses: [][]byte{[]byte(`{"name":"John","nickname":null,"age":null,"Email":null}`)},
+		errors:    []error{nil},
+	}}
+	got, err := Get[Person](context.Background(), c, []string{})
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if want := (Person{Name: "John"}); !reflect.DeepEqual(got, want) {
+		t.Errorf("Get() = %+v, want %+v", got, want)
+	}
+}
+
+func TestDoTime(t *testing.T) {
+	type Event struct {
+		Name     string         `json:"name"`
+		StartsAt time.Time      `json:"starts_at"`
+		Day      Date           `json:"day"`
+		Duration time.Duration  `json:"duration"`
+		Reminder *time.Duration `json:"reminder"`
+	}
+
+	s, err := typeToSchema(reflect.TypeOf(Event{}))
+	if err != nil {
+		t.Fatalf("typeToSchema() error = %v", err)
+	}
+	for name, want := range map[string]string{"starts_at": formatDateTime, "day": formatDate, "duration": formatDuration, "reminder": formatDuration} {
+		if prop := s.ObjectProperties[name]; prop.Type != schemaTypeString || prop.Format != want {
+			t.Errorf("field %s = %+v, want string with format %s", name, prop, want)
+		}
+	}
+
+	c := &client{llm: &mockLLM{
+		responses: [][]byte{[]byte(`{"name":"standup","starts_at":"2025-02-06 09:30:00","day":"2025-02-06","duration":"PT15M","reminder":null}`)},
+		errors:    []error{nil},
+	}}
+	got, err := Get[Event](context.Background(), c, []string{})
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	want := Event{
+		Name:     "standup",
+		StartsAt: time.Date(2025, 2, 6, 9, 30, 0, 0, time.UTC),
+		Day:      Date{Year: 2025, Month: time.February, Day: 6},
+		Duration: 15 * time.Minute,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Get() = %+v, want %+v", got, want)
+	}
+}
+
+func TestTypeToSchemaMap(t *testing.T) {
+	s, err := typeToSchema(reflect.TypeOf(map[string][]int{}))
+	if err != nil {
+		t.Fatalf("typeToSchema() error = %v", err)
+	}
+	if s.Type != schemaTypeObject || s.MapValues == nil || s.MapValues.Type != schemaTypeArray {
+		t.Errorf("typeToSchema() = %+v, want object with array values", s)
+	}
+
+	if _, err := typeToSchema(reflect.TypeOf(map[int]string{})); err != nil {
+		t.Errorf("typeToSchema() error = %v, want int keys supported", err)
+	}
+	if _, err := typeToSchema(reflect.TypeOf(map[bool]string{})); err == nil {
+		t.Error("typeToSchema() error = nil, want unsupported key type")
+	}
+}
+
+func TestDoMap(t *testing.T) {
+	type Product struct {
+		Name         string            `json:"name"`
+		Translations map[string]string `json:"translations"`
+	}
+	want := Product{Name: "apple", Translations: map[string]string{"zh": "苹果", "fr": "pomme"}}
+
+	t.Run("json object", func(t *testing.T) {
+		c := &client{llm: &mockLLM{
+			responses: [][]byte{[]byte(`{"name":"apple","translations":{"zh":"苹果","fr":"pomme"}}`)},
+			errors:    []error{nil},
+		}}
+
+		var got Product
+		if err := c.Do(context.Background(), []string{}, &got); err != nil {
+			t.Fatalf("Do() error = %v", err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Do() = %v, want %v", got, want)
+		}
+	})
+
+	t.Run("structured output", func(t *testing.T) {
+		c := &client{structuredOutput: true, llm: &mockLLM{
+			responses: [][]byte{[]byte(`{"name":"apple","translations":[{"key":"zh","value":"苹果"},{"key":"fr","value":"pomme"}]}`)},
+			errors:    []error{nil},
+		}}
+
+		var got Product
+		if err := c.Do(context.Background(), []string{}, &got); err != nil {
+			t.Fatalf("Do() error = %v", err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Do() = %v, want %v", got, want)
+		}
+	})
+
+	t.Run("structured output top-level map", func(t *testing.T) {
+		c := &client{structuredOutput: true, llm: &mockLLM{
+			responses: [][]byte{[]byte(`{"values":[{"key":"a","value":1},{"key":"b","value":2}]}`)},
+			errors:    []error{nil},
+		}}
+
+		got, err := Get[map[string]int](context.Background(), c, []string{})
+		if err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+		if want := map[string]int{"a": 1, "b": 2}; !reflect.DeepEqual(got, want) {
+			t.Errorf("Get() = %v, want %v", got, want)
+		}
+	})
+}
+
+func TestDoRecursive(t *testing.T) {
+	type Node struct {
+		Title    string `json:"title"`
+		Children []Node `json:"children"`
+	}
+
+	for _, structuredOutput := range []bool{false, true} {
+		c := &client{structuredOutput: structuredOutput, llm: &mockLLM{
+			responses: [][]byte{[]byte(`{"values":[{"title":"a","children":[{"title":"b","children":[]}]}]}`)},
+			errors:    []error{nil},
+		}}
+
+		env, err := c.responseSchema(reflect.TypeOf([]Node{}), false)
+		if err != nil {
+			t.Fatalf("responseSchema() error = %v", err)
+		}
+		if env.schema.Defs["Node"] == nil || env.schema.ObjectProperties["values"].Defs != nil {
+			t.Errorf("responseSchema() = %+v, want definitions at the root", env.schema)
+		}
+
+		got, err := Get[[]Node](context.Background(), c, []string{})
+		if err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+		if want := []Node{{Title: "a", Children: []Node{{Title: "b", Children: []Node{}}}}}; !reflect.DeepEqual(got, want) {
+			t.Errorf("Get() = %v, want %v", got, want)
+		}
+	}
+}
+
 func TestDo(t *testing.T) {
 	type TestResponse struct {
 		Message string `json:"message"`
@@ -223,6 +418,360 @@ func TestDo(t *testing.T) {
 	}
 }
 
+func TestDoNonStruct(t *testing.T) {
+	type Item struct {
+		Name string `json:"name"`
+	}
+
+	t.Run("slice of struct", func(t *testing.T) {
+		c := &client{llm: &mockLLM{
+			responses: [][]byte{[]byte(`{"values":[{"name":"a"},{"name":"b"}]}`)},
+			errors:    []error{nil},
+		}}
+
+		var got []Item
+		if err := c.Do(context.Background(), []string{}, &got); err != nil {
+			t.Fatalf("Do() error = %v", err)
+		}
+		if want := []Item{{Name: "a"}, {Name: "b"}}; !reflect.DeepEqual(got, want) {
+			t.Errorf("Do() = %v, want %v", got, want)
+		}
+	})
+
+	t.Run("primitive", func(t *testing.T) {
+		c := &client{llm: &mockLLM{
+			responses: [][]byte{[]byte(`{"value":7}`)},
+			errors:    []error{nil},
+		}}
+
+		var got int
+		if err := c.Do(context.Background(), []string{}, &got); err != nil {
+			t.Fatalf("Do() error = %v", err)
+		}
+		if got != 7 {
+			t.Errorf("Do() = %v, want 7", got)
+		}
+	})
+
+	t.Run("missing envelope key", func(t *testing.T) {
+		c := &client{llm: &mockLLM{
+			responses: [][]byte{[]byte(`{"other":7}`), []byte(`{"other":7}`)},
+			errors:    []error{nil, nil},
+		}}
+
+		var got int
+		if err := c.Do(context.Background(), []string{}, &got); err == nil {
+			t.Error("Do() error = nil, want error")
+		}
+	})
+
+	t.Run("decode error", func(t *testing.T) {
+		c := &client{llm: &mockLLM{
+			responses: [][]byte{[]byte(`{"value":"seven"}`)},
+			errors:    []error{nil},
+		}}
+
+		var got int
+		err := c.Do(context.Background(), []string{}, &got)
+		var decodeErr *DecodeError
+		if !errors.As(err, &decodeErr) {
+			t.Fatalf("Do() error = %v, want *DecodeError", err)
+		}
+		if decodeErr.Content != `{"value":"seven"}` || decodeErr.Type != reflect.TypeOf(0) {
+			t.Errorf("DecodeError = %+v, want the raw content and int type", decodeErr)
+		}
+	})
+
+	t.Run("envelope schema", func(t *testing.T) {
+		c := &client{}
+		env, err := c.responseSchema(reflect.TypeOf([]Item{}), false)
+		if err != nil {
+			t.Fatalf("responseSchema() error = %v", err)
+		}
+		if env.schema.Type != schemaTypeObject || env.schema.ObjectProperties["values"].Type != schemaTypeArray {
+			t.Errorf("responseSchema() = %+v, want object wrapping an array", env.schema)
+		}
+	})
+
+	t.Run("nil pointer", func(t *testing.T) {
+		c := &client{}
+		var got *Item
+		if err := c.Do(context.Background(), []string{}, got); err == nil {
+			t.Error("Do() error = nil, want error")
+		}
+	})
+}
+
+func TestDoMessages(t *testing.T) {
+	type TestResponse struct {
+		Message string `json:"message"`
+	}
+
+	tests := []struct {
+		name     string
+		messages []Message
+		want     TestResponse
+		wantErr  bool
+	}{
+		{
+			name: "valid roles",
+			messages: []Message{
+				{Role: RoleSystem, Content: "system"},
+				{Role: RoleUser, Content: "user"},
+				{Role: RoleAssistant, Content: "assistant"},
+			},
+			want:    TestResponse{Message: "success"},
+			wantErr: false,
+		},
+		{
+			name: "unsupported role",
+			messages: []Message{
+				{Role: "tool", Content: "tool"},
+			},
+			want:    TestResponse{},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockLLM := &mockLLM{
+				responses: [][]byte{[]byte(`{"message":"success"}`)},
+				errors:    []error{nil},
+			}
+
+			c := &client{
+				llm: mockLLM,
+			}
+
+			got, err := GetMessages[TestResponse](context.Background(), c, tt.messages)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("DoMessages() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DoMessages() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDoCallOptions(t *testing.T) {
+	t.Run("invalid temperature", func(t *testing.T) {
+		c := &client{llm: &mockLLM{}}
+		if _, err := c.String(context.Background(), []string{}, WithTemperature(3)); err == nil {
+			t.Error("String() error = nil, want error")
+		}
+	})
+
+	t.Run("options reach llm", func(t *testing.T) {
+		mockLLM := &mockLLM{
+			responses: [][]byte{[]byte(`{"value":1}`)},
+			errors:    []error{nil},
+		}
+		c := &client{llm: mockLLM}
+
+		if _, err := c.Int(context.Background(), []string{}, WithModel("cheap-model"), WithTimeout(time.Minute)); err != nil {
+			t.Fatalf("Int() error = %v", err)
+		}
+		if mockLLM.lastOptions.model != "cheap-model" {
+			t.Errorf("model = %v, want cheap-model", mockLLM.lastOptions.model)
+		}
+		if _, ok := mockLLM.lastCtx.Deadline(); !ok {
+			t.Error("context has no deadline, want timeout applied")
+		}
+	})
+}
+
+func TestDoRepair(t *testing.T) {
+	type TestResponse struct {
+		Message string `json:"message"`
+	}
+
+	t.Run("repair success", func(t *testing.T) {
+		mockLLM := &mockLLM{
+			responses: [][]byte{
+				[]byte(`{"message":1}`),
+				[]byte(`{"message":"repaired"}`),
+			},
+			errors: []error{nil, nil},
+		}
+		c := &client{llm: mockLLM, repair: 1}
+
+		messages := UserMessages("test message")
+		var got TestResponse
+		if err := c.DoMessages(context.Background(), messages, &got); err != nil {
+			t.Fatalf("DoMessages() error = %v", err)
+		}
+		if got.Message != "repaired" {
+			t.Errorf("DoMessages() = %v, want repaired", got)
+		}
+		if len(mockLLM.lastMessages) != 3 {
+			t.Fatalf("repair messages = %v, want 3 messages", mockLLM.lastMessages)
+		}
+		if m := mockLLM.lastMessages[1]; m.Role != RoleAssistant || m.Content != `{"message":1}` {
+			t.Errorf("repair messages[1] = %v, want the invalid output", m)
+		}
+		if m := mockLLM.lastMessages[2]; m.Role != RoleUser || !strings.Contains(m.Content, "$.message: must be a string, got number") {
+			t.Errorf("repair messages[2] = %v, want the validation error", m)
+		}
+		if len(messages) != 1 {
+			t.Errorf("caller messages modified: %v", messages)
+		}
+	})
+
+	t.Run("repair rounds are separate from retries", func(t *testing.T) {
+		mockLLM := &mockLLM{
+			responses: [][]byte{
+				[]byte(`{"message":1}`),
+				[]byte(`{"message":2}`),
+				nil,
+				[]byte(`{"message":"ok"}`),
+			},
+			errors: []error{nil, nil, errors.New("network error"), nil},
+		}
+		c := &client{llm: mockLLM, retry: 1}
+
+		var got TestResponse
+		if err := c.Do(context.Background(), []string{"test message"}, &got, WithRepair(2)); err != nil {
+			t.Fatalf("Do() error = %v", err)
+		}
+		if mockLLM.calls != 4 {
+			t.Errorf("calls = %d, want 4", mockLLM.calls)
+		}
+	})
+}
+
+func TestDoRetryPolicy(t *testing.T) {
+	type TestResponse struct {
+		Message string `json:"message"`
+	}
+
+	tests := []struct {
+		name      string
+		errors    []error
+		retry     int
+		policy    RetryPolicy
+		wantCalls int
+		wantErr   bool
+	}{
+		{
+			name:      "no retry",
+			errors:    []error{errors.New("network error"), nil},
+			retry:     0,
+			wantCalls: 1,
+			wantErr:   true,
+		},
+		{
+			name:      "retry with backoff",
+			errors:    []error{errors.New("network error"), &APIError{StatusCode: http.StatusServiceUnavailable}, nil},
+			retry:     2,
+			policy:    RetryPolicy{InitialBackoff: time.Millisecond, Multiplier: 2},
+			wantCalls: 3,
+			wantErr:   false,
+		},
+		{
+			name:      "non-retryable status",
+			errors:    []error{&APIError{StatusCode: http.StatusUnauthorized}, nil},
+			retry:     3,
+			wantCalls: 1,
+			wantErr:   true,
+		},
+		{
+			name:      "max elapsed time",
+			errors:    []error{&APIError{StatusCode: http.StatusTooManyRequests, retryAfter: time.Hour}, nil},
+			retry:     3,
+			policy:    RetryPolicy{MaxElapsedTime: time.Minute},
+			wantCalls: 1,
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			responses := make([][]byte, len(tt.errors))
+			responses[len(responses)-1] = []byte(`{"message":"ok"}`)
+			mockLLM := &mockLLM{responses: responses, errors: tt.errors}
+			c := &client{llm: mockLLM, retry: tt.retry, retryPolicy: tt.policy}
+
+			var got TestResponse
+			err := c.Do(context.Background(), []string{"test message"}, &got)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Do() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if mockLLM.calls != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", mockLLM.calls, tt.wantCalls)
+			}
+		})
+	}
+
+	t.Run("canceled while waiting", func(t *testing.T) {
+		mockLLM := &mockLLM{
+			responses: [][]byte{nil, []byte(`{"message":"ok"}`)},
+			errors:    []error{&APIError{StatusCode: http.StatusServiceUnavailable}, nil},
+		}
+		c := &client{llm: mockLLM, retry: 1, retryPolicy: RetryPolicy{InitialBackoff: time.Hour}}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		var got TestResponse
+		err := c.Do(ctx, []string{"test message"}, &got)
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Do() error = %v, want %v", err, context.DeadlineExceeded)
+		}
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) {
+			t.Errorf("Do() error = %v, want an APIError", err)
+		}
+		if mockLLM.calls != 1 {
+			t.Errorf("calls = %d, want 1", mockLLM.calls)
+		}
+	})
+}
+
+func TestDoMetadata(t *testing.T) {
+	type TestResponse struct {
+		Message string `json:"message"`
+	}
+
+	mockLLM := &mockLLM{
+		responses: [][]byte{nil, []byte(`{"message":1}`), []byte(`{"message":"ok"}`)},
+		errors:    []error{errors.New("network error"), nil, nil},
+		usages: []Usage{
+			{},
+			{PromptTokens: 1000, CompletionTokens: 100},
+			{PromptTokens: 1200, CompletionTokens: 100, CachedTokens: 1000},
+		},
+	}
+	c := &client{
+		llm:    mockLLM,
+		retry:  1,
+		repair: 1,
+		prices: map[string]Price{"test-model": {Prompt: 1, CachedPrompt: 0.1, Completion: 2}},
+	}
+
+	var md Metadata
+	var got TestResponse
+	if err := c.Do(context.Background(), []string{"test message"}, &got, WithModel("test-model"), WithMetadata(&md)); err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+
+	wantUsage := Usage{PromptTokens: 2200, CompletionTokens: 200, CachedTokens: 1000}
+	if md.Usage != wantUsage || md.Requests != 3 {
+		t.Errorf("Metadata = %+v, want usage %+v over 3 requests", md, wantUsage)
+	}
+	if wantCost := (1200*1 + 1000*0.1 + 200*2) / 1e6; math.Abs(md.Cost-wantCost) > 1e-12 {
+		t.Errorf("Metadata.Cost = %v, want %v", md.Cost, wantCost)
+	}
+
+	if _, err := c.String(context.Background(), []string{}); err == nil {
+		t.Fatal("String() error = nil, want error")
+	}
+	if stats := c.Stats(); stats.Usage != wantUsage || stats.Cost != md.Cost || stats.Requests != 5 {
+		t.Errorf("Stats() = %+v, want the usage and cost of both calls", stats)
+	}
+}
+
 func TestString(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -590,3 +1139,172 @@ func TestFloatSlice(t *testing.T) {
 		})
 	}
 }
+
+func TestGet(t *testing.T) {
+	type TestResponse struct {
+		Message string `json:"message"`
+	}
+
+	tests := []struct {
+		name    string
+		mock    string
+		err     error
+		want    TestResponse
+		wantErr bool
+	}{
+		{
+			name:    "successful get",
+			mock:    `{"message":"success"}`,
+			want:    TestResponse{Message: "success"},
+			wantErr: false,
+		},
+		{
+			name:    "error response",
+			mock:    `{"message":1}`,
+			want:    TestResponse{},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockLLM := &mockLLM{
+				responses: [][]byte{
+					[]byte(tt.mock),
+					[]byte(tt.mock),
+				},
+				errors: []error{nil, nil},
+			}
+
+			c := &client{
+				llm: mockLLM,
+			}
+
+			got, err := Get[TestResponse](context.Background(), c, []string{})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Get() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Get() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDoChainOfThought(t *testing.T) {
+	type Answer struct {
+		Answer int `json:"answer"`
+	}
+
+	t.Run("object", func(t *testing.T) {
+		mockLLM := &mockLLM{
+			responses: [][]byte{[]byte(`{"chain_of_thought":"6 times 7 is 42","answer":42}`)},
+			errors:    []error{nil},
+		}
+		c := &client{llm: mockLLM, chainOfThought: true}
+
+		var md Metadata
+		got, err := Get[Answer](context.Background(), c, []string{"6*7?"}, WithMetadata(&md))
+		if err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+		if got.Answer != 42 {
+			t.Errorf("Get() = %+v, want 42", got)
+		}
+		if md.ChainOfThought != "6 times 7 is 42" {
+			t.Errorf("ChainOfThought = %q, want the reasoning", md.ChainOfThought)
+		}
+		if order := mockLLM.lastSchema.PropertyOrder; !reflect.DeepEqual(order, []string{"chain_of_thought", "answer"}) {
+			t.Errorf("property order = %v, want the chain of thought first", order)
+		}
+	})
+
+	t.Run("wrapped", func(t *testing.T) {
+		mockLLM := &mockLLM{
+			responses: [][]byte{[]byte(`{"chain_of_thought":"primes below 6","values":[2,3,5]}`)},
+			errors:    []error{nil},
+		}
+		c := &client{llm: mockLLM}
+
+		var md Metadata
+		got, err := c.IntSlice(context.Background(), []string{}, WithChainOfThought(true), WithMetadata(&md))
+		if err != nil {
+			t.Fatalf("IntSlice() error = %v", err)
+		}
+		if !reflect.DeepEqual(got, []int{2, 3, 5}) || md.ChainOfThought != "primes below 6" {
+			t.Errorf("IntSlice() = %v, %q", got, md.ChainOfThought)
+		}
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		c := &client{llm: &mockLLM{
+			responses: [][]byte{[]byte(`{"answer":42}`)},
+			errors:    []error{nil},
+		}, chainOfThought: true}
+
+		_, err := Get[Answer](context.Background(), c, []string{})
+		if err == nil || !strings.Contains(err.Error(), "$.chain_of_thought: missing required property") {
+			t.Errorf("Get() error = %v, want missing chain of thought", err)
+		}
+	})
+
+	t.Run("disabled per call", func(t *testing.T) {
+		mockLLM := &mockLLM{
+			responses: [][]byte{[]byte(`{"answer":42}`)},
+			errors:    []error{nil},
+		}
+		c := &client{llm: mockLLM, chainOfThought: true}
+
+		if _, err := Get[Answer](context.Background(), c, []string{}, WithChainOfThought(false)); err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+		if _, ok := mockLLM.lastSchema.ObjectProperties["chain_of_thought"]; ok {
+			t.Error("schema has a chain of thought, want none")
+		}
+	})
+
+	t.Run("fragment result", func(t *testing.T) {
+		mockLLM := &mockLLM{
+			responses: [][]byte{[]byte(`{"chain_of_thought":"the origin","value":{"x":0,"y":0}}`)},
+			errors:    []error{nil},
+		}
+		c := &client{llm: mockLLM, chainOfThought: true, structuredOutput: true}
+
+		var md Metadata
+		if _, err := Get[rawPoint](context.Background(), c, []string{}, WithMetadata(&md)); err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+		if md.ChainOfThought != "the origin" {
+			t.Errorf("ChainOfThought = %q, want %q", md.ChainOfThought, "the origin")
+		}
+		properties := convertToOpenAISchema(mockLLM.lastSchema, true, false)["properties"].(orderedObject)
+		if !reflect.DeepEqual(properties.keys, []string{"chain_of_thought", "value"}) {
+			t.Errorf("properties = %v, want the chain of thought and the wrapped fragment", properties.keys)
+		}
+	})
+
+	t.Run("name conflict", func(t *testing.T) {
+		type Result struct {
+			ChainOfThought string `json:"chain_of_thought"`
+		}
+		c := &client{}
+		env, err := c.responseSchema(reflect.TypeOf(Result{}), true)
+		if err != nil {
+			t.Fatalf("responseSchema() error = %v", err)
+		}
+		if env.chainOfThought != "_chain_of_thought" || len(env.schema.ObjectProperties) != 2 {
+			t.Errorf("responseSchema() = %+v, want a distinct chain of thought property", env)
+		}
+	})
+}
+
+// rawPoint supplies an object schema fragment
+type rawPoint struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+func (rawPoint) JSONSchema() json.RawMessage {
+	return json.RawMessage(`{"type": "object", "properties": {"x": {"type": "integer"}, "y": {"type": "integer"}}, "required": ["x", "y"], "additionalProperties": false}`)
+}
@@ -0,0 +1,150 @@
+package llmstructed
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Date is a civil date without a time or location, such as a birthday or a due date.
+// It is encoded as "2006-01-02", and generated as a string with format "date".
+type Date struct {
+	Year  int
+	Month time.Month
+	Day   int
+}
+
+// DateOf returns the date of t in its location.
+func DateOf(t time.Time) Date {
+	year, month, day := t.Date()
+	return Date{Year: year, Month: month, Day: day}
+}
+
+// ParseDate parses a date in the form "2006-01-02". A date-time in RFC 3339 is accepted as well, its date is kept.
+func ParseDate(s string) (Date, error) {
+	if t, err := time.Parse(time.DateOnly, s); err == nil {
+		return DateOf(t), nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return DateOf(t), nil
+	}
+	return Date{}, errors.Errorf("invalid date %q, want YYYY-MM-DD", s)
+}
+
+// String returns the date in the form "2006-01-02".
+func (d Date) String() string {
+	return d.In(time.UTC).Format(time.DateOnly)
+}
+
+// In returns the time at midnight of the date in loc.
+func (d Date) In(loc *time.Location) time.Time {
+	return time.Date(d.Year, d.Month, d.Day, 0, 0, 0, 0, loc)
+}
+
+// IsZero reports whether d is the zero value.
+func (d Date) IsZero() bool {
+	return d == Date{}
+}
+
+// MarshalText encodes d as "2006-01-02", or an empty string if d is zero.
+func (d Date) MarshalText() ([]byte, error) {
+	if d.IsZero() {
+		return []byte{}, nil
+	}
+	return []byte(d.String()), nil
+}
+
+// UnmarshalText decodes a date parsed by ParseDate. An empty string is decoded as the zero value.
+func (d *Date) UnmarshalText(data []byte) error {
+	if len(data) == 0 {
+		*d = Date{}
+		return nil
+	}
+	date, err := ParseDate(string(data))
+	if err != nil {
+		return err
+	}
+	*d = date
+	return nil
+}
+
+// dateTimeLayouts are accepted for date-times, since models often omit the time zone or the time.
+var dateTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05Z07:00",
+	time.DateTime,
+	time.DateOnly,
+}
+
+// parseDateTime parses a date-time in RFC 3339 or a common variant of it, in UTC if the time zone is missing.
+func parseDateTime(s string) (time.Time, bool) {
+	for _, layout := range dateTimeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// parseDuration parses a duration in ISO 8601, e.g. "PT1H30M", or in Go, e.g. "1h30m".
+// ISO 8601 years and months are not supported, since their length varies.
+func parseDuration(s string) (time.Duration, bool) {
+	if d, err := time.ParseDuration(s); err == nil {
+		return d, true
+	}
+
+	rest, negative := strings.CutPrefix(strings.ToUpper(s), "-")
+	rest, ok := strings.CutPrefix(rest, "P")
+	if !ok {
+		return 0, false
+	}
+	var (
+		total         float64
+		inTime, units bool
+	)
+	for rest != "" {
+		if rest[0] == 'T' && !inTime {
+			inTime = true
+			rest = rest[1:]
+			continue
+		}
+		i := strings.IndexFunc(rest, func(r rune) bool {
+			return (r < '0' || r > '9') && r != '.' && r != ','
+		})
+		if i <= 0 {
+			return 0, false
+		}
+		n, err := strconv.ParseFloat(strings.Replace(rest[:i], ",", ".", 1), 64)
+		if err != nil {
+			return 0, false
+		}
+		var unit time.Duration
+		switch u := rest[i]; {
+		case !inTime && u == 'W':
+			unit = 7 * 24 * time.Hour
+		case !inTime && u == 'D':
+			unit = 24 * time.Hour
+		case inTime && u == 'H':
+			unit = time.Hour
+		case inTime && u == 'M':
+			unit = time.Minute
+		case inTime && u == 'S':
+			unit = time.Second
+		default:
+			return 0, false
+		}
+		total += n * float64(unit)
+		units = true
+		rest = rest[i+1:]
+	}
+	if !units {
+		return 0, false
+	}
+	if negative {
+		total = -total
+	}
+	return time.Duration(total), true
+}
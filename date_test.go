@@ -0,0 +1,87 @@
+package llmstructed
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDate(t *testing.T) {
+	d, err := ParseDate("2025-02-06")
+	assert.NoError(t, err)
+	assert.Equal(t, Date{Year: 2025, Month: time.February, Day: 6}, d)
+	assert.Equal(t, "2025-02-06", d.String())
+	assert.Equal(t, time.Date(2025, 2, 6, 0, 0, 0, 0, time.UTC), d.In(time.UTC))
+
+	d, err = ParseDate("2025-02-06T23:30:00+08:00")
+	assert.NoError(t, err)
+	assert.Equal(t, Date{Year: 2025, Month: time.February, Day: 6}, d)
+
+	_, err = ParseDate("06/02/2025")
+	assert.Error(t, err)
+
+	var v struct {
+		Due  Date `json:"due"`
+		Done Date `json:"done"`
+	}
+	assert.NoError(t, json.Unmarshal([]byte(`{"due":"2025-12-31","done":""}`), &v))
+	assert.Equal(t, Date{Year: 2025, Month: time.December, Day: 31}, v.Due)
+	assert.True(t, v.Done.IsZero())
+	data, err := json.Marshal(v)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"due":"2025-12-31","done":""}`, string(data))
+}
+
+func TestParseDateTime(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Time
+		ok    bool
+	}{
+		{value: "2025-02-06T10:30:00Z", want: time.Date(2025, 2, 6, 10, 30, 0, 0, time.UTC), ok: true},
+		{value: "2025-02-06T10:30:00+08:00", want: time.Date(2025, 2, 6, 2, 30, 0, 0, time.UTC), ok: true},
+		{value: "2025-02-06T10:30:00", want: time.Date(2025, 2, 6, 10, 30, 0, 0, time.UTC), ok: true},
+		{value: "2025-02-06 10:30:00", want: time.Date(2025, 2, 6, 10, 30, 0, 0, time.UTC), ok: true},
+		{value: "2025-02-06", want: time.Date(2025, 2, 6, 0, 0, 0, 0, time.UTC), ok: true},
+		{value: "yesterday", ok: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, ok := parseDateTime(tt.value)
+			assert.Equal(t, tt.ok, ok)
+			if tt.ok {
+				assert.True(t, tt.want.Equal(got), "got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+		ok    bool
+	}{
+		{value: "1h30m", want: 90 * time.Minute, ok: true},
+		{value: "PT1H30M", want: 90 * time.Minute, ok: true},
+		{value: "P1DT12H", want: 36 * time.Hour, ok: true},
+		{value: "P2W", want: 14 * 24 * time.Hour, ok: true},
+		{value: "PT0.5S", want: 500 * time.Millisecond, ok: true},
+		{value: "-PT10M", want: -10 * time.Minute, ok: true},
+		{value: "P1M", ok: false},
+		{value: "P1Y", ok: false},
+		{value: "PT", ok: false},
+		{value: "an hour", ok: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, ok := parseDuration(tt.value)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package llmstructed
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrNoChoices is returned when the response contains no choices.
+	ErrNoChoices = errors.New("no choices in response")
+	// ErrRefused is returned when the model refuses to answer, or its answer is filtered by the provider.
+	ErrRefused = errors.New("model refused to respond")
+	// ErrTruncated is returned when the response is cut off, usually by WithMaxTokens or the context window.
+	ErrTruncated = errors.New("response truncated")
+)
+
+// APIError is returned when the endpoint responds with a non-200 status code.
+type APIError struct {
+	// StatusCode is the HTTP status code.
+	StatusCode int
+	// Code is the provider specific error code, e.g. "rate_limit_exceeded". Empty if not provided.
+	Code string
+	// Message is the provider error message. Empty if the body is not an OpenAI compatible error.
+	Message string
+	// RequestID identifies the request for the provider support. Empty if not provided.
+	RequestID string
+	// Body is the raw response body.
+	Body string
+
+	retryAfter time.Duration
+}
+
+func (e *APIError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "unexpected status code: %d", e.StatusCode)
+	if e.Message == "" {
+		fmt.Fprintf(&b, ", body: %s", e.Body)
+	} else {
+		if e.Code != "" {
+			fmt.Fprintf(&b, ", code: %s", e.Code)
+		}
+		fmt.Fprintf(&b, ", message: %s", e.Message)
+	}
+	if e.RequestID != "" {
+		fmt.Fprintf(&b, ", request id: %s", e.RequestID)
+	}
+	return b.String()
+}
+
+// parseBody fills the provider error code and message from an OpenAI compatible error body,
+// e.g. {"error": {"message": "...", "code": "..."}}.
+func (e *APIError) parseBody() {
+	var body struct {
+		Error struct {
+			Message string          `json:"message"`
+			Type    string          `json:"type"`
+			Code    json.RawMessage `json:"code"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal([]byte(e.Body), &body); err != nil {
+		return
+	}
+	e.Message = body.Error.Message
+
+	// The code is a string for OpenAI, but a number for some other providers.
+	var code any
+	if err := json.Unmarshal(body.Error.Code, &code); err == nil && code != nil {
+		e.Code = fmt.Sprint(code)
+	}
+	if e.Code == "" {
+		e.Code = body.Error.Type
+	}
+}
+
+// DecodeError is returned when the model output cannot be unmarshalled into the result, or is invalid.
+type DecodeError struct {
+	// Content is the raw model output.
+	Content string
+	// Type is the type the output is unmarshalled into.
+	Type reflect.Type
+	// Err is the underlying unmarshal error, or a ValidationError.
+	Err error
+}
+
+func (e *DecodeError) Error() string {
+	var validationErr *ValidationError
+	if errors.As(e.Err, &validationErr) {
+		return fmt.Sprintf("invalid response for %s: %s: %v", e.Type, e.Content, e.Err)
+	}
+	return fmt.Sprintf("unmarshal response into %s: %s: %v", e.Type, e.Content, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// ValidationError is returned, as the Err of a DecodeError, when the model output doesn't match the schema
+// of the result, e.g. a missing required property or a value outside its enum, or fails a Validator.
+type ValidationError struct {
+	Violations []Violation
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		messages[i] = v.String()
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Violation is a value of the model output that doesn't match the schema.
+type Violation struct {
+	// Path locates the value in the model output, e.g. "$.items[3].category".
+	Path    string
+	Message string
+}
+
+func (v Violation) String() string {
+	return v.Path + ": " + v.Message
+}
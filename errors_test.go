@@ -0,0 +1,67 @@
+package llmstructed
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPIErrorParseBody(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		wantCode    string
+		wantMessage string
+	}{
+		{
+			name:        "openai error",
+			body:        `{"error":{"message":"Rate limit reached","type":"requests","code":"rate_limit_exceeded"}}`,
+			wantCode:    "rate_limit_exceeded",
+			wantMessage: "Rate limit reached",
+		},
+		{
+			name:        "numeric code",
+			body:        `{"error":{"message":"Insufficient credits","code":402}}`,
+			wantCode:    "402",
+			wantMessage: "Insufficient credits",
+		},
+		{
+			name:        "type without code",
+			body:        `{"error":{"message":"Authentication Fails","type":"authentication_error","code":null}}`,
+			wantCode:    "authentication_error",
+			wantMessage: "Authentication Fails",
+		},
+		{
+			name: "not json",
+			body: "502 Bad Gateway",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &APIError{StatusCode: http.StatusBadRequest, Body: tt.body}
+			e.parseBody()
+			assert.Equal(t, tt.wantCode, e.Code)
+			assert.Equal(t, tt.wantMessage, e.Message)
+		})
+	}
+}
+
+func TestAPIErrorError(t *testing.T) {
+	e := &APIError{StatusCode: http.StatusBadGateway, Body: "502 Bad Gateway"}
+	assert.Equal(t, "unexpected status code: 502, body: 502 Bad Gateway", e.Error())
+
+	e = &APIError{StatusCode: http.StatusTooManyRequests, Code: "rate_limit_exceeded", Message: "Rate limit reached", RequestID: "req_123"}
+	assert.Equal(t, "unexpected status code: 429, code: rate_limit_exceeded, message: Rate limit reached, request id: req_123", e.Error())
+}
+
+func TestDecodeErrorError(t *testing.T) {
+	e := &DecodeError{Content: `{"value":"seven"}`, Type: reflect.TypeOf(0), Err: errors.New("invalid character")}
+	assert.Equal(t, `unmarshal response into int: {"value":"seven"}: invalid character`, e.Error())
+
+	e = &DecodeError{Content: `{"end":1}`, Type: reflect.TypeOf(period{}), Err: &ValidationError{Violations: []Violation{{Path: "$", Message: "end is before start"}}}}
+	assert.Equal(t, `invalid response for llmstructed.period: {"end":1}: $: end is before start`, e.Error())
+}
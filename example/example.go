@@ -11,7 +11,7 @@ type Summary struct {
 	Title    string   `json:"title" desc:"The title of the summary"`
 	Content  string   `json:"content" desc:"A concise summary of the article content"`
 	Keywords []string `json:"keywords" desc:"Key topics mentioned in the article"`
-	Score    int      `json:"score" desc:"The quality score of the article (1-10)"`
+	Score    int      `json:"score" desc:"The quality score of the article" min:"1" max:"10"`
 	Category string   `json:"category" desc:"The category of the article" enum:"Technology,Science,Business,Health,Education,Other"`
 }
 
@@ -39,6 +39,7 @@ func main() {
 	has revolutionized AI by using neural networks to process complex patterns in data.`,
 	}, &summary)
 	fmt.Printf("Go Struct: %v\n\n", summary)
+	// Or with generics: summary, err := llmstructed.Get[Summary](ctx, cli, messages)
 
 	// Simple method for single value
 	str, _ := cli.String(ctx, []string{"Hello, who are you?"})
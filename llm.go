@@ -1,22 +1,48 @@
 package llmstructed
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"maps"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/mock"
 )
 
 type llm interface {
-	Completions(ctx context.Context, messages []string, responseSchema *schema) ([]byte, error)
+	// Completions returns the model output.
+	// The completion is also returned with ErrRefused and ErrTruncated, since its tokens are consumed anyway.
+	Completions(ctx context.Context, messages []Message, responseSchema *schema, opts *callOptions) (*completion, error)
+	// Stream is like Completions, but streams the response, and calls onContent with the content received so far
+	// each time it grows. An error returned by onContent aborts the stream and is returned as is.
+	Stream(ctx context.Context, messages []Message, responseSchema *schema, opts *callOptions, onContent func(content []byte) error) (*completion, error)
 }
 
+type completion struct {
+	content []byte
+	// reasoning is the reasoning of reasoning models, reported separately or in a think block.
+	reasoning string
+	usage     Usage
+	// model is the requested model, used to look up its price.
+	model string
+}
+
+// SchemaPlaceholder is replaced by the JSON Schema of the response in prompt templates.
+const SchemaPlaceholder = "{{schema}}"
+
+const (
+	defaultSystemPrompt = "You are a helpful assistant that provides structured output. Your response must be a valid JSON object."
+	defaultSchemaPrompt = "You must format your response as a JSON object following this schema: \n" + SchemaPlaceholder + "\nDo not include any other text in your response."
+)
+
 type schemaType string
 
 const (
@@ -26,14 +52,47 @@ const (
 	schemaTypeBoolean schemaType = "boolean"
 	schemaTypeArray   schemaType = "array"
 	schemaTypeObject  schemaType = "object"
+	schemaTypeNull    schemaType = "null"
+)
+
+// Formats of string schemas with decoding support.
+const (
+	formatDateTime = "date-time"
+	formatDate     = "date"
+	formatDuration = "duration"
 )
 
 type schema struct {
 	Type             schemaType
 	Description      string
+	Format           string
 	Enum             []string
 	ArrayItems       *schema
 	ObjectProperties map[string]*schema
+	// PropertyOrder lists the names of ObjectProperties in generation order, see propertyNames.
+	PropertyOrder []string
+	// Minimum and Maximum bound a number or integer.
+	Minimum, Maximum *float64
+	// MinLength, MaxLength and Pattern constrain a string.
+	MinLength, MaxLength *int
+	Pattern              string
+	// MinItems and MaxItems bound the length of an array.
+	MinItems, MaxItems *int
+	// MapValues is the schema of the values of a map, whose keys are free-form.
+	MapValues *schema
+	// KeyValuePairs marks an array of {"key", "value"} objects representing a map,
+	// since strict structured output forbids free-form keys.
+	KeyValuePairs bool
+	// Optional marks an object property that may be absent, i.e. a pointer or omitempty field,
+	// or array items and map values that may be null, i.e. pointers.
+	// It is nullable in strict structured output, which requires every property.
+	Optional bool
+	// Ref is the name of the definition in Defs of the root schema this schema stands for.
+	Ref string
+	// Defs holds the definitions of named types used more than once or recursively, only set on the root.
+	Defs map[string]*schema
+	// Raw is the schema supplied by a JSONSchemaProvider, used as is.
+	Raw map[string]interface{}
 }
 
 type llmConfig struct {
@@ -42,7 +101,11 @@ type llmConfig struct {
 	APIKey                    string
 	Model                     string
 	Temperature               float32
+	ReasoningEffort           string
 	StructuredOutputSupported bool
+	PropertyOrderingSupported bool
+	SystemPrompt              string
+	SchemaPrompt              string
 }
 
 type openai struct {
@@ -50,38 +113,170 @@ type openai struct {
 	hc     httpClient
 }
 
-func (o *openai) Completions(ctx context.Context, messages []string, responseSchema *schema) ([]byte, error) {
+func (o *openai) Completions(ctx context.Context, messages []Message, responseSchema *schema, opts *callOptions) (*completion, error) {
+	resp, model, err := o.send(ctx, messages, responseSchema, opts, false)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// Read response body
+	respBodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "read response body")
+	}
+
+	if o.config.Debug {
+		fmt.Println("Response:")
+		fmt.Println(string(respBodyBytes))
+	}
+
+	// Parse response
+	var response chatCompletion
+	if err := json.Unmarshal(respBodyBytes, &response); err != nil {
+		return nil, errors.Wrapf(err, "unmarshal response body: %s", respBodyBytes)
+	}
+	if len(response.Choices) == 0 {
+		return nil, ErrNoChoices
+	}
+	choice := response.Choices[0]
+	reasoning := firstNonEmpty(choice.Message.ReasoningContent, choice.Message.Reasoning)
+	return newCompletion(choice.Message.Content, reasoning, choice.Message.Refusal, choice.FinishReason, response.Usage, model)
+}
+
+func (o *openai) Stream(ctx context.Context, messages []Message, responseSchema *schema, opts *callOptions, onContent func(content []byte) error) (*completion, error) {
+	resp, model, err := o.send(ctx, messages, responseSchema, opts, true)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// Read server-sent events until [DONE], each carries a chunk of the response
+	var (
+		content, reasoning, refusal strings.Builder
+		finishReason                string
+		usage                       chatUsage
+		hasChoices                  bool
+	)
+	reader := bufio.NewReader(resp.Body)
+	for {
+		line, readErr := reader.ReadBytes('\n')
+		if readErr != nil && readErr != io.EOF {
+			return nil, errors.Wrap(readErr, "read response stream")
+		}
+		data, ok := bytes.CutPrefix(bytes.TrimSpace(line), []byte("data:"))
+		data = bytes.TrimSpace(data)
+		if ok && string(data) == "[DONE]" {
+			break
+		}
+		if ok && len(data) > 0 {
+			var chunk chatCompletionChunk
+			if err := json.Unmarshal(data, &chunk); err != nil {
+				return nil, errors.Wrapf(err, "unmarshal response chunk: %s", data)
+			}
+			if chunk.Error != nil {
+				// Some providers report errors in the stream after responding 200
+				apiErr := &APIError{StatusCode: resp.StatusCode, RequestID: resp.Header.Get("X-Request-Id"), Body: string(data)}
+				apiErr.parseBody()
+				return nil, apiErr
+			}
+			if chunk.Usage != nil {
+				usage = *chunk.Usage
+			}
+			if len(chunk.Choices) > 0 {
+				hasChoices = true
+				choice := chunk.Choices[0]
+				refusal.WriteString(choice.Delta.Refusal)
+				reasoning.WriteString(firstNonEmpty(choice.Delta.ReasoningContent, choice.Delta.Reasoning))
+				if choice.FinishReason != "" {
+					finishReason = choice.FinishReason
+				}
+				if choice.Delta.Content != "" {
+					content.WriteString(choice.Delta.Content)
+					// Nothing to decode until the think block is closed
+					if answer, _ := splitThinking(content.String()); answer != "" {
+						if err := onContent([]byte(answer)); err != nil {
+							return nil, err
+						}
+					}
+				}
+			}
+		}
+		if readErr == io.EOF {
+			break
+		}
+	}
+
+	if o.config.Debug {
+		fmt.Println("Response:")
+		fmt.Println(content.String())
+	}
+	if !hasChoices {
+		return nil, ErrNoChoices
+	}
+	return newCompletion(content.String(), reasoning.String(), refusal.String(), finishReason, usage, model)
+}
+
+// send sends the chat completion request, and returns the response if it is 200, together with the requested model.
+func (o *openai) send(ctx context.Context, messages []Message, responseSchema *schema, opts *callOptions, stream bool) (*http.Response, string, error) {
 	baseURL := strings.TrimRight(o.config.BaseURL, "/")
 	url := baseURL + "/chat/completions"
 
-	// Build chat messages
-	chatMessages := make([]map[string]string, 0, len(messages)+2)
-	chatMessages = append(chatMessages, map[string]string{
-		"role":    "system",
-		"content": "You are a helpful assistant that provides structured output. Your response must be a valid JSON object.",
-	})
-	for _, msg := range messages {
-		chatMessages = append(chatMessages, map[string]string{
-			"role":    "user",
-			"content": msg,
+	jsonSchema, err := json.Marshal(convertToOpenAISchema(responseSchema, o.config.StructuredOutputSupported, false))
+	if err != nil {
+		return nil, "", errors.Wrap(err, "marshal response schema")
+	}
+	systemPrompt := firstNonEmpty(opts.systemPrompt, o.config.SystemPrompt, defaultSystemPrompt)
+	schemaPrompt := firstNonEmpty(opts.schemaPrompt, o.config.SchemaPrompt, defaultSchemaPrompt)
+
+	// Build chat messages, the system prompt is used unless the caller provides one
+	chatMessages := make([]Message, 0, len(messages)+2)
+	if !hasSystemMessage(messages) {
+		chatMessages = append(chatMessages, Message{
+			Role:    RoleSystem,
+			Content: strings.ReplaceAll(systemPrompt, SchemaPlaceholder, string(jsonSchema)),
 		})
 	}
+	chatMessages = append(chatMessages, messages...)
 
 	// Build request body
+	temperature := o.config.Temperature
+	if opts.temperature != nil {
+		temperature = *opts.temperature
+	}
+	model := firstNonEmpty(opts.model, o.config.Model)
+	reasoningEffort := firstNonEmpty(opts.reasoningEffort, o.config.ReasoningEffort)
 	reqBody := map[string]interface{}{
-		"model":       o.config.Model,
-		"temperature": o.config.Temperature,
+		"model": model,
 		"provider": map[string]interface{}{
 			"require_parameters": true,
 		},
 	}
+	if reasoningEffort != "" {
+		reqBody["reasoning_effort"] = reasoningEffort
+	}
+	// Reasoning models reject sampling parameters
+	if !isReasoningModel(model) && reasoningEffort == "" {
+		reqBody["temperature"] = temperature
+	}
+	if opts.maxTokens > 0 {
+		// Reasoning models reject max_tokens, as their limit includes the reasoning tokens
+		if isReasoningModel(model) {
+			reqBody["max_completion_tokens"] = opts.maxTokens
+		} else {
+			reqBody["max_tokens"] = opts.maxTokens
+		}
+	}
+	if opts.seed != nil {
+		reqBody["seed"] = *opts.seed
+	}
 	if o.config.StructuredOutputSupported {
 		reqBody["response_format"] = map[string]interface{}{
 			"type": "json_schema",
 			"json_schema": map[string]interface{}{
 				"name":   "response",
 				"strict": true,
-				"schema": convertToOpenAISchema(responseSchema),
+				"schema": convertToOpenAISchema(responseSchema, true, o.config.PropertyOrderingSupported),
 			},
 		}
 		reqBody["messages"] = chatMessages
@@ -89,24 +284,26 @@ func (o *openai) Completions(ctx context.Context, messages []string, responseSch
 		reqBody["response_format"] = map[string]interface{}{
 			"type": "json_object",
 		}
-		jsonSchema, err := json.Marshal(convertToOpenAISchema(responseSchema))
-		if err != nil {
-			return nil, errors.Wrap(err, "marshal response schema")
-		}
-		reqBody["messages"] = append(chatMessages, map[string]string{
-			"role":    "user",
-			"content": fmt.Sprintf("You must format your response as a JSON object following this schema: \n%s\nDo not include any other text in your response.", jsonSchema),
+		reqBody["messages"] = append(chatMessages, Message{
+			Role:    RoleUser,
+			Content: strings.ReplaceAll(schemaPrompt, SchemaPlaceholder, string(jsonSchema)),
 		})
 	}
+	if stream {
+		reqBody["stream"] = true
+		reqBody["stream_options"] = map[string]interface{}{
+			"include_usage": true,
+		}
+	}
 	reqBodyBytes, err := json.Marshal(reqBody)
 	if err != nil {
-		return nil, errors.Wrap(err, "marshal request body")
+		return nil, "", errors.Wrap(err, "marshal request body")
 	}
 
 	// Build request
 	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(reqBodyBytes))
 	if err != nil {
-		return nil, errors.Wrap(err, "create request")
+		return nil, "", errors.Wrap(err, "create request")
 	}
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", o.config.APIKey))
@@ -124,73 +321,334 @@ func (o *openai) Completions(ctx context.Context, messages []string, responseSch
 	// Send request
 	resp, err := o.hc.Do(req)
 	if err != nil {
-		return nil, errors.Wrap(err, "send request")
+		return nil, "", errors.Wrap(err, "send request")
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		respBodyBytes, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, "", errors.Wrap(err, "read response body")
+		}
+		apiErr := &APIError{
+			StatusCode: resp.StatusCode,
+			RequestID:  resp.Header.Get("X-Request-Id"),
+			Body:       string(respBodyBytes),
+			retryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+		}
+		apiErr.parseBody()
+		return nil, "", apiErr
 	}
-	defer resp.Body.Close()
 
-	// Read response body
-	respBodyBytes, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, errors.Wrap(err, "read response body")
+	return resp, model, nil
+
+}
+
+func newCompletion(content, reasoning, refusal, finishReason string, usage chatUsage, model string) (*completion, error) {
+	answer, thinking := splitThinking(content)
+	result := &completion{
+		content:   []byte(answer),
+		reasoning: strings.TrimSpace(reasoning + "\n" + thinking),
+		usage:     usage.toUsage(),
+		model:     model,
 	}
-	if resp.StatusCode != http.StatusOK {
-		return nil, errors.Errorf("unexpected status code: %d, body: %s", resp.StatusCode, string(respBodyBytes))
+	switch {
+	case refusal != "":
+		return result, errors.Wrap(ErrRefused, refusal)
+	case finishReason == "content_filter":
+		return result, errors.Wrap(ErrRefused, "content filtered")
+	case finishReason == "length":
+		return result, errors.Wrapf(ErrTruncated, "partial content: %s", content)
 	}
+	return result, nil
+}
 
-	if o.config.Debug {
-		fmt.Println("Response:")
-		fmt.Println(string(respBodyBytes))
+// reasoningModelPrefixes match the names of reasoning models, which reject sampling parameters like temperature.
+var reasoningModelPrefixes = []string{"deepseek-reasoner", "o1", "o3", "o4", "gpt-5"}
+
+func isReasoningModel(model string) bool {
+	// Ignore the vendor prefix of routers, e.g. openai/o3-mini
+	if _, name, ok := strings.Cut(model, "/"); ok {
+		model = name
 	}
+	for _, prefix := range reasoningModelPrefixes {
+		if model == prefix || strings.HasPrefix(model, prefix+"-") {
+			return true
+		}
+	}
+	return false
+}
 
-	// Parse response
-	var response struct {
-		Choices []struct {
-			Message struct {
-				Content string `json:"content"`
-			} `json:"message"`
-		} `json:"choices"`
+// splitThinking splits the leading <think> blocks, generated by some reasoning models before the answer,
+// from content. The answer is empty while a think block is still open.
+func splitThinking(content string) (answer, thinking string) {
+	const openTag, closeTag = "<think>", "</think>"
+	const space = " \t\r\n"
+	answer = content
+	for {
+		rest, ok := strings.CutPrefix(strings.TrimLeft(answer, space), openTag)
+		if !ok {
+			return answer, thinking
+		}
+		block, after, closed := strings.Cut(rest, closeTag)
+		thinking += block
+		if !closed {
+			return "", thinking
+		}
+		answer = strings.TrimLeft(after, space)
 	}
-	if err := json.Unmarshal(respBodyBytes, &response); err != nil {
-		return nil, errors.Wrap(err, "unmarshal response")
+}
+
+type chatCompletion struct {
+	Choices []struct {
+		Message struct {
+			Content string `json:"content"`
+			Refusal string `json:"refusal"`
+			// ReasoningContent is reported by DeepSeek, Reasoning by OpenRouter.
+			ReasoningContent string `json:"reasoning_content"`
+			Reasoning        string `json:"reasoning"`
+		} `json:"message"`
+		FinishReason string `json:"finish_reason"`
+	} `json:"choices"`
+	Usage chatUsage `json:"usage"`
+}
+
+type chatCompletionChunk struct {
+	Choices []struct {
+		Delta struct {
+			Content          string `json:"content"`
+			Refusal          string `json:"refusal"`
+			ReasoningContent string `json:"reasoning_content"`
+			Reasoning        string `json:"reasoning"`
+		} `json:"delta"`
+		FinishReason string `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *chatUsage       `json:"usage"`
+	Error *json.RawMessage `json:"error"`
+}
+
+type chatUsage struct {
+	PromptTokens        int `json:"prompt_tokens"`
+	CompletionTokens    int `json:"completion_tokens"`
+	PromptTokensDetails struct {
+		CachedTokens int `json:"cached_tokens"`
+	} `json:"prompt_tokens_details"`
+	CompletionTokensDetails struct {
+		ReasoningTokens int `json:"reasoning_tokens"`
+	} `json:"completion_tokens_details"`
+	// DeepSeek reports cached tokens in its own field.
+	PromptCacheHitTokens int `json:"prompt_cache_hit_tokens"`
+}
+
+func (u chatUsage) toUsage() Usage {
+	return Usage{
+		PromptTokens:     u.PromptTokens,
+		CompletionTokens: u.CompletionTokens,
+		CachedTokens:     max(u.PromptTokensDetails.CachedTokens, u.PromptCacheHitTokens),
+		ReasoningTokens:  u.CompletionTokensDetails.ReasoningTokens,
 	}
-	if len(response.Choices) == 0 {
-		return nil, errors.New("no choices in response")
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func hasSystemMessage(messages []Message) bool {
+	for _, msg := range messages {
+		if msg.Role == RoleSystem {
+			return true
+		}
+	}
+	return false
+}
+
+// orderedObject is a JSON object marshalled with its keys in order, unlike a map.
+type orderedObject struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+func (o orderedObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, key := range o.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		k, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		v, err := json.Marshal(o.values[key])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(k)
+		buf.WriteByte(':')
+		buf.Write(v)
 	}
-	return []byte(response.Choices[0].Message.Content), nil
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// strictKeywords are the constraint keywords supported by strict structured output.
+// See https://platform.openai.com/docs/guides/structured-outputs#supported-properties
+var strictKeywords = map[string]bool{
+	"minimum":  true,
+	"maximum":  true,
+	"pattern":  true,
+	"minItems": true,
+	"maxItems": true,
+}
+
+// strictFormats are the string formats supported by strict structured output, others are described.
+var strictFormats = map[string]bool{
+	"date-time": true,
+	"date":      true,
+	"time":      true,
+	"duration":  true,
+	"email":     true,
+	"hostname":  true,
+	"ipv4":      true,
+	"ipv6":      true,
+	"uuid":      true,
 }
 
-func convertToOpenAISchema(s *schema) map[string]interface{} {
+// convertToOpenAISchema converts s to JSON Schema, with properties in generation order.
+// In strict mode, every property is required, so optional properties are nullable instead.
+// ordering adds the propertyOrdering keyword of Gemini, which doesn't follow the order of properties.
+func convertToOpenAISchema(s *schema, strict, ordering bool) map[string]interface{} {
+	nullable := strict && s.Optional
+	if s.Ref != "" || s.Raw != nil {
+		inner := maps.Clone(s.Raw)
+		if s.Ref != "" {
+			inner = map[string]interface{}{"$ref": "#/$defs/" + s.Ref}
+		}
+		result := inner
+		if nullable {
+			result = map[string]interface{}{
+				"anyOf": []interface{}{inner, map[string]interface{}{"type": schemaTypeNull}},
+			}
+		}
+		if s.Description != "" {
+			result["description"] = s.Description
+		}
+		return result
+	}
+
 	result := map[string]interface{}{
 		"type": s.Type,
 	}
+	if nullable {
+		result["type"] = []schemaType{s.Type, schemaTypeNull}
+	}
 
-	if s.Description != "" {
-		result["description"] = s.Description
+	// Keywords unsupported by strict structured output are described instead, to be still followed
+	var described []string
+	for _, c := range []struct {
+		keyword string
+		value   interface{}
+		set     bool
+	}{
+		{"minimum", s.Minimum, s.Minimum != nil},
+		{"maximum", s.Maximum, s.Maximum != nil},
+		{"minLength", s.MinLength, s.MinLength != nil},
+		{"maxLength", s.MaxLength, s.MaxLength != nil},
+		{"pattern", s.Pattern, s.Pattern != ""},
+		{"format", s.Format, s.Format != ""},
+		{"minItems", s.MinItems, s.MinItems != nil},
+		{"maxItems", s.MaxItems, s.MaxItems != nil},
+	} {
+		switch {
+		case !c.set:
+		case strict && !strictKeywords[c.keyword] && !(c.keyword == "format" && strictFormats[s.Format]):
+			value, _ := json.Marshal(c.value)
+			described = append(described, c.keyword+": "+string(value))
+		default:
+			result[c.keyword] = c.value
+		}
+	}
+
+	description := s.Description
+	if len(described) > 0 {
+		description = strings.TrimSpace(description + " (" + strings.Join(described, ", ") + ")")
+	}
+	if description != "" {
+		result["description"] = description
 	}
 
 	if len(s.Enum) > 0 {
-		result["enum"] = s.Enum
+		enum := make([]interface{}, 0, len(s.Enum)+1)
+		for _, v := range s.Enum {
+			if s.Type == schemaTypeString {
+				enum = append(enum, v)
+			} else {
+				enum = append(enum, json.Number(v))
+			}
+		}
+		if nullable {
+			// null must be allowed by the enum too
+			enum = append(enum, nil)
+		}
+		result["enum"] = enum
 	}
 
 	if s.ArrayItems != nil {
-		result["items"] = convertToOpenAISchema(s.ArrayItems)
+		result["items"] = convertToOpenAISchema(s.ArrayItems, strict, ordering)
 	}
 
 	if len(s.ObjectProperties) > 0 {
-		properties := make(map[string]interface{})
-		names := make([]string, 0, len(s.ObjectProperties))
-		for k, v := range s.ObjectProperties {
-			properties[k] = convertToOpenAISchema(v)
-			names = append(names, k)
+		names := propertyNames(s)
+		properties := orderedObject{keys: names, values: make(map[string]interface{}, len(names))}
+		required := make([]string, 0, len(names))
+		for _, name := range names {
+			property := s.ObjectProperties[name]
+			properties.values[name] = convertToOpenAISchema(property, strict, ordering)
+			if strict || !property.Optional {
+				required = append(required, name)
+			}
 		}
 		result["properties"] = properties
-		result["required"] = names
+		result["required"] = required
 		result["additionalProperties"] = false
+		if ordering {
+			result["propertyOrdering"] = names
+		}
+	}
+
+	if s.MapValues != nil {
+		result["additionalProperties"] = convertToOpenAISchema(s.MapValues, strict, ordering)
+	}
+
+	if len(s.Defs) > 0 {
+		defs := make(map[string]interface{}, len(s.Defs))
+		for name, def := range s.Defs {
+			defs[name] = convertToOpenAISchema(def, strict, ordering)
+		}
+		result["$defs"] = defs
 	}
 
 	return result
 }
 
+// parseRetryAfter parses the Retry-After header, in either delay-seconds or HTTP-date form.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(max(seconds, 0)) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(date.Sub(now), 0)
+	}
+	return 0
+}
+
 type httpClient interface {
 	Do(req *http.Request) (*http.Response, error)
 }
@@ -210,15 +668,42 @@ func (m *mockHTTPClient) Do(req *http.Request) (*http.Response, error) {
 type mockLLM struct {
 	responses [][]byte
 	errors    []error
+	usages    []Usage
 	calls     int
+
+	lastCtx      context.Context
+	lastMessages []Message
+	lastSchema   *schema
+	lastOptions  *callOptions
 }
 
-func (m *mockLLM) Completions(ctx context.Context, messages []string, responseSchema *schema) ([]byte, error) {
+func (m *mockLLM) Completions(ctx context.Context, messages []Message, responseSchema *schema, opts *callOptions) (*completion, error) {
+	m.lastCtx, m.lastMessages, m.lastSchema, m.lastOptions = ctx, messages, responseSchema, opts
 	if m.calls < len(m.responses) {
-		resp := m.responses[m.calls]
+		resp := &completion{content: m.responses[m.calls], model: opts.model}
+		if m.calls < len(m.usages) {
+			resp.usage = m.usages[m.calls]
+		}
 		err := m.errors[m.calls]
 		m.calls++
-		return resp, err
+		if err != nil {
+			return nil, err
+		}
+		return resp, nil
 	}
 	return nil, errors.New("no more responses")
 }
+
+// Stream calls onContent with each prefix of the next response, as if it were generated byte by byte.
+func (m *mockLLM) Stream(ctx context.Context, messages []Message, responseSchema *schema, opts *callOptions, onContent func(content []byte) error) (*completion, error) {
+	if m.calls < len(m.responses) && m.errors[m.calls] == nil {
+		content := m.responses[m.calls]
+		for i := 1; i <= len(content); i++ {
+			if err := onContent(content[:i]); err != nil {
+				m.calls++
+				return nil, err
+			}
+		}
+	}
+	return m.Completions(ctx, messages, responseSchema, opts)
+}
@@ -19,12 +19,15 @@ func TestCompletions(t *testing.T) {
 		when         string
 		then         string
 		config       llmConfig
-		messages     []string
+		messages     []Message
+		callOptions  []CallOption
 		schema       *schema
 		mockResponse string
 		mockStatus   int
+		mockHeader   http.Header
 		mockHTTPErr  error
 		expectErr    bool
+		errorFunc    func(t *testing.T, err error)
 		validateFunc func(t *testing.T, req *http.Request)
 	}{
 		{
@@ -36,7 +39,7 @@ func TestCompletions(t *testing.T) {
 				APIKey:      "test-key",
 				Temperature: 0.7,
 			},
-			messages: []string{"Hello"},
+			messages: UserMessages("Hello"),
 			schema: &schema{
 				Type: schemaTypeString,
 			},
@@ -59,13 +62,127 @@ func TestCompletions(t *testing.T) {
 				APIKey:      "test-key",
 				Temperature: 0.7,
 			},
-			messages: []string{"Hello"},
+			messages: UserMessages("Hello"),
+			schema: &schema{
+				Type: schemaTypeString,
+			},
+			mockResponse: `{"error":{"message":"invalid request","code":"invalid_request_error"}}`,
+			mockStatus:   http.StatusBadRequest,
+			mockHeader:   http.Header{"X-Request-Id": []string{"req_123"}},
+			expectErr:    true,
+			errorFunc: func(t *testing.T, err error) {
+				var apiErr *APIError
+				if assert.ErrorAs(t, err, &apiErr) {
+					assert.Equal(t, http.StatusBadRequest, apiErr.StatusCode)
+					assert.Equal(t, "invalid_request_error", apiErr.Code)
+					assert.Equal(t, "invalid request", apiErr.Message)
+					assert.Equal(t, "req_123", apiErr.RequestID)
+				}
+			},
+		},
+		{
+			scenario: "Non-OpenAI Error Response",
+			given:    "valid request",
+			when:     "API returns an error body not shaped like OpenAI's",
+			then:     "should return error",
+			config: llmConfig{
+				APIKey:      "test-key",
+				Temperature: 0.7,
+			},
+			messages: UserMessages("Hello"),
 			schema: &schema{
 				Type: schemaTypeString,
 			},
 			mockResponse: `{"error": "invalid request"}`,
 			mockStatus:   http.StatusBadRequest,
 			expectErr:    true,
+			errorFunc: func(t *testing.T, err error) {
+				var apiErr *APIError
+				if assert.ErrorAs(t, err, &apiErr) {
+					assert.Equal(t, http.StatusBadRequest, apiErr.StatusCode)
+					assert.Empty(t, apiErr.Message)
+					assert.Equal(t, `{"error": "invalid request"}`, apiErr.Body)
+				}
+			},
+		},
+		{
+			scenario: "No Choices",
+			given:    "valid request",
+			when:     "API returns no choices",
+			then:     "should return ErrNoChoices",
+			config: llmConfig{
+				APIKey: "test-key",
+			},
+			messages: UserMessages("Hello"),
+			schema: &schema{
+				Type: schemaTypeString,
+			},
+			mockResponse: `{"choices":[]}`,
+			mockStatus:   http.StatusOK,
+			expectErr:    true,
+			errorFunc: func(t *testing.T, err error) {
+				assert.ErrorIs(t, err, ErrNoChoices)
+			},
+		},
+		{
+			scenario: "Refusal",
+			given:    "valid request",
+			when:     "the model refuses to respond",
+			then:     "should return ErrRefused",
+			config: llmConfig{
+				APIKey: "test-key",
+			},
+			messages: UserMessages("Hello"),
+			schema: &schema{
+				Type: schemaTypeString,
+			},
+			mockResponse: `{"choices":[{"message":{"content":null,"refusal":"I can't help with that."},"finish_reason":"stop"}]}`,
+			mockStatus:   http.StatusOK,
+			expectErr:    true,
+			errorFunc: func(t *testing.T, err error) {
+				assert.ErrorIs(t, err, ErrRefused)
+				assert.Contains(t, err.Error(), "I can't help with that.")
+			},
+		},
+		{
+			scenario: "Truncated",
+			given:    "valid request",
+			when:     "the response hits the token limit",
+			then:     "should return ErrTruncated",
+			config: llmConfig{
+				APIKey: "test-key",
+			},
+			messages: UserMessages("Hello"),
+			schema: &schema{
+				Type: schemaTypeString,
+			},
+			mockResponse: `{"choices":[{"message":{"content":"{\"value\":\"Hel"},"finish_reason":"length"}]}`,
+			mockStatus:   http.StatusOK,
+			expectErr:    true,
+			errorFunc: func(t *testing.T, err error) {
+				assert.ErrorIs(t, err, ErrTruncated)
+			},
+		},
+		{
+			scenario: "Malformed Response",
+			given:    "valid request",
+			when:     "API returns a body that is not JSON",
+			then:     "should return an error with the body, but no DecodeError",
+			config: llmConfig{
+				APIKey: "test-key",
+			},
+			messages: UserMessages("Hello"),
+			schema: &schema{
+				Type: schemaTypeString,
+			},
+			mockResponse: `<html>gateway</html>`,
+			mockStatus:   http.StatusOK,
+			expectErr:    true,
+			errorFunc: func(t *testing.T, err error) {
+				var decodeErr *DecodeError
+				assert.False(t, errors.As(err, &decodeErr))
+				assert.ErrorContains(t, err, "<html>gateway</html>")
+			},
 		},
 		{
 			scenario: "Schema Validation",
@@ -77,7 +194,7 @@ func TestCompletions(t *testing.T) {
 				Temperature:               0.7,
 				StructuredOutputSupported: true,
 			},
-			messages: []string{"Hello"},
+			messages: UserMessages("Hello"),
 			schema: &schema{
 				Type: schemaTypeObject,
 				ObjectProperties: map[string]*schema{
@@ -103,7 +220,7 @@ func TestCompletions(t *testing.T) {
 				APIKey:      "test-key",
 				Temperature: 0.7,
 			},
-			messages: []string{"Hello"},
+			messages: UserMessages("Hello"),
 			schema: &schema{
 				Type: schemaTypeString,
 			},
@@ -120,7 +237,7 @@ func TestCompletions(t *testing.T) {
 				Temperature:               0.7,
 				StructuredOutputSupported: true,
 			},
-			messages: []string{"Hello"},
+			messages: UserMessages("Hello"),
 			schema: &schema{
 				Type: schemaTypeObject,
 				ObjectProperties: map[string]*schema{
@@ -158,7 +275,7 @@ func TestCompletions(t *testing.T) {
 				Temperature:               0.7,
 				StructuredOutputSupported: true,
 			},
-			messages: []string{"Hello"},
+			messages: UserMessages("Hello"),
 			schema: &schema{
 				Type: schemaTypeObject,
 				ObjectProperties: map[string]*schema{
@@ -192,7 +309,7 @@ func TestCompletions(t *testing.T) {
 				Temperature:               0.7,
 				StructuredOutputSupported: true,
 			},
-			messages: []string{"Hello"},
+			messages: UserMessages("Hello"),
 			schema: &schema{
 				Type: schemaTypeObject,
 				ObjectProperties: map[string]*schema{
@@ -211,6 +328,244 @@ func TestCompletions(t *testing.T) {
 				assert.Contains(t, string(body), `"enum":["pending","active","completed"]`)
 			},
 		},
+		{
+			scenario: "Schema With Map",
+			given:    "schema with a map property",
+			when:     "calling completions without structured output",
+			then:     "should describe the map values with additionalProperties",
+			config: llmConfig{
+				APIKey: "test-key",
+			},
+			messages: UserMessages("Hello"),
+			schema: &schema{
+				Type: schemaTypeObject,
+				ObjectProperties: map[string]*schema{
+					"translations": {
+						Type:      schemaTypeObject,
+						MapValues: &schema{Type: schemaTypeString},
+					},
+				},
+			},
+			mockResponse: `{"choices":[{"message":{"content":"{\"translations\":{}}"}}]}`,
+			mockStatus:   http.StatusOK,
+			expectErr:    false,
+			validateFunc: func(t *testing.T, req *http.Request) {
+				body, err := io.ReadAll(req.Body)
+				assert.NoError(t, err)
+				assert.Contains(t, string(body), `\"translations\":{\"additionalProperties\":{\"type\":\"string\"},\"type\":\"object\"}`)
+			},
+		},
+		{
+			scenario: "Optional Properties In Strict Mode",
+			given:    "schema with optional properties",
+			when:     "calling completions with structured output",
+			then:     "should require them as nullable",
+			config: llmConfig{
+				APIKey:                    "test-key",
+				StructuredOutputSupported: true,
+			},
+			messages: UserMessages("Hello"),
+			schema: &schema{
+				Type: schemaTypeObject,
+				ObjectProperties: map[string]*schema{
+					"nickname": {Type: schemaTypeString, Optional: true},
+					"status":   {Type: schemaTypeString, Enum: []string{"active"}, Optional: true},
+				},
+			},
+			mockResponse: `{"choices":[{"message":{"content":"{\"nickname\":null,\"status\":null}"}}]}`,
+			mockStatus:   http.StatusOK,
+			expectErr:    false,
+			validateFunc: func(t *testing.T, req *http.Request) {
+				body, err := io.ReadAll(req.Body)
+				assert.NoError(t, err)
+				assert.Contains(t, string(body), `"nickname":{"type":["string","null"]}`)
+				assert.Contains(t, string(body), `"enum":["active",null]`)
+				assert.Regexp(t, `"required":\["(nickname|status)","(nickname|status)"\]`, string(body))
+			},
+		},
+		{
+			scenario: "Optional Properties In JSON Object Mode",
+			given:    "schema with optional properties",
+			when:     "calling completions without structured output",
+			then:     "should not require them",
+			config: llmConfig{
+				APIKey: "test-key",
+			},
+			messages: UserMessages("Hello"),
+			schema: &schema{
+				Type: schemaTypeObject,
+				ObjectProperties: map[string]*schema{
+					"name":     {Type: schemaTypeString},
+					"nickname": {Type: schemaTypeString, Optional: true},
+				},
+			},
+			mockResponse: `{"choices":[{"message":{"content":"{\"name\":\"John\"}"}}]}`,
+			mockStatus:   http.StatusOK,
+			expectErr:    false,
+			validateFunc: func(t *testing.T, req *http.Request) {
+				body, err := io.ReadAll(req.Body)
+				assert.NoError(t, err)
+				assert.Contains(t, string(body), `\"nickname\":{\"type\":\"string\"}`)
+				assert.Contains(t, string(body), `\"required\":[\"name\"]`)
+			},
+		},
+		{
+			scenario: "Role-aware Messages",
+			given:    "system, few-shot and user messages",
+			when:     "calling completions",
+			then:     "should pass roles through and skip the default system prompt",
+			config: llmConfig{
+				APIKey:      "test-key",
+				Temperature: 0.7,
+			},
+			messages: []Message{
+				{Role: RoleSystem, Content: "You are a classifier."},
+				{Role: RoleUser, Content: "apple"},
+				{Role: RoleAssistant, Content: `{"value":"fruit"}`},
+				{Role: RoleUser, Content: "carrot"},
+			},
+			schema: &schema{
+				Type: schemaTypeString,
+			},
+			mockResponse: `{"choices":[{"message":{"content":"{\"value\":\"vegetable\"}"}}]}`,
+			mockStatus:   http.StatusOK,
+			expectErr:    false,
+			validateFunc: func(t *testing.T, req *http.Request) {
+				body, err := io.ReadAll(req.Body)
+				assert.NoError(t, err)
+				assert.Contains(t, string(body), `{"role":"system","content":"You are a classifier."}`)
+				assert.Contains(t, string(body), `{"role":"assistant","content":"{\"value\":\"fruit\"}"}`)
+				assert.NotContains(t, string(body), "You are a helpful assistant")
+			},
+		},
+		{
+			scenario: "Configured Prompts",
+			given:    "custom system and schema prompts",
+			when:     "calling completions without structured output",
+			then:     "should render the schema into both prompts",
+			config: llmConfig{
+				APIKey:       "test-key",
+				SystemPrompt: "你是一个结构化输出助手",
+				SchemaPrompt: "请按照以下 JSON Schema 输出: {{schema}}",
+			},
+			messages: UserMessages("Hello"),
+			schema: &schema{
+				Type: schemaTypeString,
+			},
+			mockResponse: `{"choices":[{"message":{"content":"Hello"}}]}`,
+			mockStatus:   http.StatusOK,
+			expectErr:    false,
+			validateFunc: func(t *testing.T, req *http.Request) {
+				body, err := io.ReadAll(req.Body)
+				assert.NoError(t, err)
+				assert.Contains(t, string(body), "你是一个结构化输出助手")
+				assert.Contains(t, string(body), `请按照以下 JSON Schema 输出: {\"type\":\"string\"}`)
+				assert.NotContains(t, string(body), "You must format your response")
+			},
+		},
+		{
+			scenario: "Per-call Prompts",
+			given:    "configured prompts and per-call overrides",
+			when:     "calling completions",
+			then:     "should prefer the per-call prompts",
+			config: llmConfig{
+				APIKey:       "test-key",
+				SystemPrompt: "config system prompt",
+				SchemaPrompt: "config schema prompt {{schema}}",
+			},
+			messages:    UserMessages("Hello"),
+			callOptions: []CallOption{WithSystemPrompt("call system prompt"), WithSchemaPrompt("call schema prompt {{schema}}")},
+			schema: &schema{
+				Type: schemaTypeString,
+			},
+			mockResponse: `{"choices":[{"message":{"content":"Hello"}}]}`,
+			mockStatus:   http.StatusOK,
+			expectErr:    false,
+			validateFunc: func(t *testing.T, req *http.Request) {
+				body, err := io.ReadAll(req.Body)
+				assert.NoError(t, err)
+				assert.Contains(t, string(body), "call system prompt")
+				assert.Contains(t, string(body), "call schema prompt")
+				assert.NotContains(t, string(body), "config")
+			},
+		},
+		{
+			scenario: "Per-call Parameters",
+			given:    "per-call model, temperature, max tokens and seed",
+			when:     "calling completions",
+			then:     "should merge them over the config",
+			config: llmConfig{
+				APIKey:      "test-key",
+				Model:       "config-model",
+				Temperature: 0.7,
+			},
+			messages:    UserMessages("Hello"),
+			callOptions: []CallOption{WithModel("call-model"), WithTemperature(0), WithMaxTokens(512), WithSeed(7)},
+			schema: &schema{
+				Type: schemaTypeString,
+			},
+			mockResponse: `{"choices":[{"message":{"content":"Hello"}}]}`,
+			mockStatus:   http.StatusOK,
+			expectErr:    false,
+			validateFunc: func(t *testing.T, req *http.Request) {
+				body, err := io.ReadAll(req.Body)
+				assert.NoError(t, err)
+				assert.Contains(t, string(body), `"model":"call-model"`)
+				assert.Contains(t, string(body), `"temperature":0`)
+				assert.Contains(t, string(body), `"max_tokens":512`)
+				assert.Contains(t, string(body), `"seed":7`)
+			},
+		},
+		{
+			scenario: "Reasoning Model Max Tokens",
+			given:    "a reasoning model and max tokens",
+			when:     "calling completions",
+			then:     "should send max_completion_tokens instead of max_tokens",
+			config: llmConfig{
+				APIKey: "test-key",
+				Model:  "o3-mini",
+			},
+			messages:    UserMessages("Hello"),
+			callOptions: []CallOption{WithMaxTokens(512)},
+			schema: &schema{
+				Type: schemaTypeString,
+			},
+			mockResponse: `{"choices":[{"message":{"content":"Hello"}}]}`,
+			mockStatus:   http.StatusOK,
+			expectErr:    false,
+			validateFunc: func(t *testing.T, req *http.Request) {
+				body, err := io.ReadAll(req.Body)
+				assert.NoError(t, err)
+				assert.Contains(t, string(body), `"max_completion_tokens":512`)
+				assert.NotContains(t, string(body), `"max_tokens"`)
+			},
+		},
+		{
+			scenario: "Reasoning Model",
+			given:    "a reasoning model and reasoning effort",
+			when:     "calling completions",
+			then:     "should send the effort but no temperature, and strip the think block",
+			config: llmConfig{
+				APIKey:          "test-key",
+				Model:           "deepseek-reasoner",
+				Temperature:     0.7,
+				ReasoningEffort: "low",
+			},
+			messages:    UserMessages("Hello"),
+			callOptions: []CallOption{WithReasoningEffort("high")},
+			schema: &schema{
+				Type: schemaTypeString,
+			},
+			mockResponse: `{"choices":[{"message":{"content":"<think>greet back</think>\n{\"value\":\"Hello\"}","reasoning_content":"a greeting"}}]}`,
+			mockStatus:   http.StatusOK,
+			expectErr:    false,
+			validateFunc: func(t *testing.T, req *http.Request) {
+				body, err := io.ReadAll(req.Body)
+				assert.NoError(t, err)
+				assert.Contains(t, string(body), `"reasoning_effort":"high"`)
+				assert.NotContains(t, string(body), `"temperature"`)
+			},
+		},
 		{
 			scenario: "Context Cancellation",
 			given:    "context is cancelled",
@@ -220,7 +575,7 @@ func TestCompletions(t *testing.T) {
 				APIKey:      "test-key",
 				Temperature: 0.7,
 			},
-			messages: []string{"Hello"},
+			messages: UserMessages("Hello"),
 			schema: &schema{
 				Type: schemaTypeString,
 			},
@@ -237,6 +592,7 @@ func TestCompletions(t *testing.T) {
 			} else {
 				mockClient.On("Do", mock.Anything).Return(&http.Response{
 					StatusCode: tc.mockStatus,
+					Header:     tc.mockHeader,
 					Body:       io.NopCloser(strings.NewReader(tc.mockResponse)),
 				}, nil)
 			}
@@ -246,9 +602,12 @@ func TestCompletions(t *testing.T) {
 				hc:     mockClient,
 			}
 
-			resp, err := llm.Completions(context.Background(), tc.messages, tc.schema)
+			resp, err := llm.Completions(context.Background(), tc.messages, tc.schema, newCallOptions(tc.callOptions))
 			if tc.expectErr {
 				assert.Error(t, err)
+				if tc.errorFunc != nil {
+					tc.errorFunc(t, err)
+				}
 				return
 			}
 
@@ -263,3 +622,200 @@ func TestCompletions(t *testing.T) {
 		})
 	}
 }
+
+func TestCompletionsUsage(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want Usage
+	}{
+		{
+			name: "openai",
+			body: `{"choices":[{"message":{"content":"{}"}}],"usage":{"prompt_tokens":100,"completion_tokens":50,"total_tokens":150,` +
+				`"prompt_tokens_details":{"cached_tokens":80},"completion_tokens_details":{"reasoning_tokens":30}}}`,
+			want: Usage{PromptTokens: 100, CompletionTokens: 50, CachedTokens: 80, ReasoningTokens: 30},
+		},
+		{
+			name: "deepseek",
+			body: `{"choices":[{"message":{"content":"{}"}}],"usage":{"prompt_tokens":100,"completion_tokens":50,` +
+				`"prompt_cache_hit_tokens":64,"prompt_cache_miss_tokens":36}}`,
+			want: Usage{PromptTokens: 100, CompletionTokens: 50, CachedTokens: 64},
+		},
+		{
+			name: "missing",
+			body: `{"choices":[{"message":{"content":"{}"}}]}`,
+			want: Usage{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockClient := &mockHTTPClient{}
+			mockClient.On("Do", mock.Anything).Return(&http.Response{
+				StatusCode: http.StatusOK,
+				Body:       io.NopCloser(strings.NewReader(tt.body)),
+			}, nil)
+			llm := &openai{config: llmConfig{APIKey: "test-key", Model: "test-model"}, hc: mockClient}
+
+			resp, err := llm.Completions(context.Background(), UserMessages("Hello"), &schema{Type: schemaTypeString}, newCallOptions(nil))
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, resp.usage)
+			assert.Equal(t, "test-model", resp.model)
+		})
+	}
+}
+
+func TestStream(t *testing.T) {
+	tests := []struct {
+		name          string
+		body          string
+		wantChunks    []string
+		wantContent   string
+		wantReasoning string
+		wantUsage     Usage
+		wantErr       error
+	}{
+		{
+			name: "chunks and usage",
+			body: "data: {\"choices\":[{\"delta\":{\"role\":\"assistant\",\"content\":\"\"}}]}\n\n" +
+				": keep-alive\n\n" +
+				"data: {\"choices\":[{\"delta\":{\"content\":\"{\\\"value\\\":\"}}]}\n\n" +
+				"data: {\"choices\":[{\"delta\":{\"content\":\"\\\"hi\\\"}\"},\"finish_reason\":\"stop\"}]}\n\n" +
+				"data: {\"choices\":[],\"usage\":{\"prompt_tokens\":10,\"completion_tokens\":5}}\n\n" +
+				"data: [DONE]\n\n",
+			wantChunks:  []string{`{"value":`, `{"value":"hi"}`},
+			wantContent: `{"value":"hi"}`,
+			wantUsage:   Usage{PromptTokens: 10, CompletionTokens: 5},
+		},
+		{
+			name: "think block",
+			body: "data: {\"choices\":[{\"delta\":{\"content\":\"<think>say \"}}]}\n\n" +
+				"data: {\"choices\":[{\"delta\":{\"content\":\"hi</think>\\n\"}}]}\n\n" +
+				"data: {\"choices\":[{\"delta\":{\"content\":\"{\\\"value\\\":\\\"hi\\\"}\"},\"finish_reason\":\"stop\"}]}\n\n",
+			wantChunks:    []string{`{"value":"hi"}`},
+			wantContent:   `{"value":"hi"}`,
+			wantReasoning: "say hi",
+		},
+		{
+			name: "reasoning content",
+			body: "data: {\"choices\":[{\"delta\":{\"reasoning_content\":\"say \"}}]}\n\n" +
+				"data: {\"choices\":[{\"delta\":{\"reasoning_content\":\"hi\"}}]}\n\n" +
+				"data: {\"choices\":[{\"delta\":{\"content\":\"{\\\"value\\\":\\\"hi\\\"}\"},\"finish_reason\":\"stop\"}]}\n\n",
+			wantChunks:    []string{`{"value":"hi"}`},
+			wantContent:   `{"value":"hi"}`,
+			wantReasoning: "say hi",
+		},
+		{
+			name:        "truncated",
+			body:        "data: {\"choices\":[{\"delta\":{\"content\":\"{\\\"value\\\":\"},\"finish_reason\":\"length\"}]}\n\n",
+			wantChunks:  []string{`{"value":`},
+			wantContent: `{"value":`,
+			wantErr:     ErrTruncated,
+		},
+		{
+			name:    "no choices",
+			body:    "data: [DONE]\n\n",
+			wantErr: ErrNoChoices,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockClient := &mockHTTPClient{}
+			mockClient.On("Do", mock.Anything).Return(&http.Response{
+				StatusCode: http.StatusOK,
+				Body:       io.NopCloser(strings.NewReader(tt.body)),
+			}, nil)
+			llm := &openai{config: llmConfig{APIKey: "test-key"}, hc: mockClient}
+
+			var chunks []string
+			resp, err := llm.Stream(context.Background(), UserMessages("Hello"), &schema{Type: schemaTypeString}, newCallOptions(nil), func(content []byte) error {
+				chunks = append(chunks, string(content))
+				return nil
+			})
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.wantChunks, chunks)
+			if resp != nil {
+				assert.Equal(t, tt.wantContent, string(resp.content))
+				assert.Equal(t, tt.wantReasoning, resp.reasoning)
+				assert.Equal(t, tt.wantUsage, resp.usage)
+			}
+
+			req := mockClient.Calls[0].Arguments[0].(*http.Request)
+			body, err := io.ReadAll(req.Body)
+			assert.NoError(t, err)
+			assert.Contains(t, string(body), `"stream":true`)
+		})
+	}
+
+	t.Run("error event", func(t *testing.T) {
+		mockClient := &mockHTTPClient{}
+		mockClient.On("Do", mock.Anything).Return(&http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader("data: {\"error\":{\"message\":\"overloaded\",\"code\":\"server_error\"}}\n\n")),
+		}, nil)
+		llm := &openai{config: llmConfig{APIKey: "test-key"}, hc: mockClient}
+
+		_, err := llm.Stream(context.Background(), UserMessages("Hello"), &schema{Type: schemaTypeString}, newCallOptions(nil), func([]byte) error { return nil })
+		var apiErr *APIError
+		if assert.ErrorAs(t, err, &apiErr) {
+			assert.Equal(t, "server_error", apiErr.Code)
+		}
+	})
+}
+
+func TestSplitThinking(t *testing.T) {
+	tests := []struct {
+		content      string
+		wantAnswer   string
+		wantThinking string
+	}{
+		{content: `{"a":1}`, wantAnswer: `{"a":1}`},
+		{content: "<think>hmm</think>\n{\"a\":1}", wantAnswer: `{"a":1}`, wantThinking: "hmm"},
+		{content: "\n<think>one</think><think> two</think>{}", wantAnswer: "{}", wantThinking: "one two"},
+		{content: "<think>still thinking", wantAnswer: "", wantThinking: "still thinking"},
+		{content: `{"text":"<think>"}`, wantAnswer: `{"text":"<think>"}`},
+	}
+	for _, tt := range tests {
+		answer, thinking := splitThinking(tt.content)
+		assert.Equal(t, tt.wantAnswer, answer, tt.content)
+		assert.Equal(t, tt.wantThinking, thinking, tt.content)
+	}
+}
+
+func TestIsReasoningModel(t *testing.T) {
+	for model, want := range map[string]bool{
+		"deepseek-reasoner": true,
+		"o3-mini":           true,
+		"openai/o4-mini":    true,
+		"gpt-5":             true,
+		"deepseek-chat":     false,
+		"gpt-4o":            false,
+		"o3x":               false,
+	} {
+		assert.Equal(t, want, isReasoningModel(model), model)
+	}
+}
+
+func TestCompletionsReasoning(t *testing.T) {
+	mockClient := &mockHTTPClient{}
+	mockClient.On("Do", mock.Anything).Return(&http.Response{
+		StatusCode: http.StatusOK,
+		Body: io.NopCloser(strings.NewReader(
+			`{"choices":[{"message":{"content":"<think>greet back</think>\n{\"value\":\"Hello\"}","reasoning_content":"a greeting"}}]}`)),
+	}, nil)
+	llm := &openai{config: llmConfig{APIKey: "test-key", Model: "deepseek-reasoner"}, hc: mockClient}
+
+	resp, err := llm.Completions(context.Background(), UserMessages("Hello"), &schema{Type: schemaTypeString}, newCallOptions(nil))
+	assert.NoError(t, err)
+	assert.Equal(t, `{"value":"Hello"}`, string(resp.content))
+	assert.Equal(t, "a greeting\ngreet back", resp.reasoning)
+
+	var md Metadata
+	md.add(resp, nil)
+	assert.Equal(t, "a greeting\ngreet back", md.Reasoning)
+}
@@ -0,0 +1,107 @@
+package llmstructed
+
+import "time"
+
+// CallOption overrides the client Config for a single call.
+type CallOption func(*callOptions)
+
+type callOptions struct {
+	systemPrompt    string
+	schemaPrompt    string
+	model           string
+	temperature     *float32
+	reasoningEffort string
+	maxTokens       int
+	seed            *int
+	timeout         time.Duration
+	repair          *int
+	chainOfThought  *bool
+	metadata        *Metadata
+	items           *itemStream
+}
+
+func newCallOptions(opts []CallOption) *callOptions {
+	o := &callOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithSystemPrompt overrides Config.SystemPrompt for a single call.
+func WithSystemPrompt(prompt string) CallOption {
+	return func(o *callOptions) {
+		o.systemPrompt = prompt
+	}
+}
+
+// WithSchemaPrompt overrides Config.SchemaPrompt for a single call.
+func WithSchemaPrompt(prompt string) CallOption {
+	return func(o *callOptions) {
+		o.schemaPrompt = prompt
+	}
+}
+
+// WithModel overrides Config.Model for a single call.
+func WithModel(model string) CallOption {
+	return func(o *callOptions) {
+		o.model = model
+	}
+}
+
+// WithTemperature overrides Config.Temperature for a single call.
+func WithTemperature(temperature float32) CallOption {
+	return func(o *callOptions) {
+		o.temperature = &temperature
+	}
+}
+
+// WithReasoningEffort overrides Config.ReasoningEffort for a single call.
+func WithReasoningEffort(effort string) CallOption {
+	return func(o *callOptions) {
+		o.reasoningEffort = effort
+	}
+}
+
+// WithMaxTokens limits the number of tokens the model can generate in a single call.
+func WithMaxTokens(maxTokens int) CallOption {
+	return func(o *callOptions) {
+		o.maxTokens = maxTokens
+	}
+}
+
+// WithSeed asks the model to sample deterministically, if supported by the provider.
+func WithSeed(seed int) CallOption {
+	return func(o *callOptions) {
+		o.seed = &seed
+	}
+}
+
+// WithTimeout limits the duration of a single call, including retries.
+func WithTimeout(timeout time.Duration) CallOption {
+	return func(o *callOptions) {
+		o.timeout = timeout
+	}
+}
+
+// WithRepair overrides Config.Repair for a single call.
+func WithRepair(repair int) CallOption {
+	return func(o *callOptions) {
+		o.repair = &repair
+	}
+}
+
+// WithChainOfThought overrides Config.ChainOfThought for a single call.
+func WithChainOfThought(enabled bool) CallOption {
+	return func(o *callOptions) {
+		o.chainOfThought = &enabled
+	}
+}
+
+// WithMetadata fills md with the details of the call, such as the token usage and estimated cost,
+// whether the call succeeds or not.
+func WithMetadata(md *Metadata) CallOption {
+	return func(o *callOptions) {
+		o.metadata = md
+	}
+}
@@ -0,0 +1,114 @@
+package llmstructed
+
+import (
+	"context"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// RetryPolicy controls how failed requests are retried.
+// The number of retries is still controlled by Config.Retry.
+type RetryPolicy struct {
+	// InitialBackoff is the delay before the first retry.
+	// Default: 500ms
+	InitialBackoff time.Duration
+	// MaxBackoff caps the delay between two retries, except for delays requested by the server via Retry-After.
+	// Default: 30s
+	MaxBackoff time.Duration
+	// Multiplier grows the delay after each retry.
+	// Default: 2
+	Multiplier float64
+	// Jitter randomizes each delay by up to ±Jitter*delay, to avoid retrying in lockstep with other clients.
+	// Must be between 0 and 1.
+	// Default: 0
+	Jitter float64
+	// MaxElapsedTime stops retrying once the next attempt would start after it, measured from the start of the call.
+	// Default: 0, no limit
+	MaxElapsedTime time.Duration
+}
+
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.InitialBackoff == 0 {
+		p.InitialBackoff = 500 * time.Millisecond
+	}
+	if p.MaxBackoff == 0 {
+		p.MaxBackoff = 30 * time.Second
+	}
+	if p.Multiplier == 0 {
+		p.Multiplier = 2
+	}
+	return p
+}
+
+func (p RetryPolicy) validate() error {
+	if p.InitialBackoff < 0 || p.MaxBackoff < 0 || p.MaxElapsedTime < 0 {
+		return errors.New("retry policy durations must not be negative")
+	}
+	if p.Multiplier != 0 && p.Multiplier < 1 {
+		return errors.New("retry policy multiplier must not be less than 1")
+	}
+	if p.Jitter < 0 || p.Jitter > 1 {
+		return errors.New("retry policy jitter must be between 0 and 1")
+	}
+	return nil
+}
+
+// backoff returns the delay before the n-th retry, starting from 1.
+func (p RetryPolicy) backoff(n int, err error) time.Duration {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.retryAfter > 0 {
+		return apiErr.retryAfter
+	}
+
+	delay := float64(p.InitialBackoff) * math.Pow(math.Max(p.Multiplier, 1), float64(n-1))
+	if p.MaxBackoff > 0 {
+		delay = math.Min(delay, float64(p.MaxBackoff))
+	}
+	if p.Jitter > 0 {
+		delay += delay * p.Jitter * (2*rand.Float64() - 1)
+	}
+	return time.Duration(delay)
+}
+
+// retryable reports whether retrying may succeed after err.
+func retryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	// The identical request is very likely to be refused or truncated again.
+	if errors.Is(err, ErrRefused) || errors.Is(err, ErrTruncated) {
+		return false
+	}
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.StatusCode {
+		case http.StatusRequestTimeout, http.StatusConflict, http.StatusTooEarly, http.StatusTooManyRequests:
+			return true
+		default:
+			return apiErr.StatusCode >= 500
+		}
+	}
+
+	// Network and decode errors.
+	return true
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,73 @@
+package llmstructed
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	p := RetryPolicy{InitialBackoff: time.Second, MaxBackoff: 5 * time.Second, Multiplier: 2}
+
+	assert.Equal(t, time.Second, p.backoff(1, errors.New("network error")))
+	assert.Equal(t, 2*time.Second, p.backoff(2, errors.New("network error")))
+	assert.Equal(t, 4*time.Second, p.backoff(3, errors.New("network error")))
+	assert.Equal(t, 5*time.Second, p.backoff(4, errors.New("network error")))
+
+	retryAfter := &APIError{StatusCode: http.StatusTooManyRequests, retryAfter: time.Minute}
+	assert.Equal(t, time.Minute, p.backoff(1, errors.Wrap(retryAfter, "wrapped")))
+
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		d := p.backoff(1, errors.New("network error"))
+		assert.GreaterOrEqual(t, d, 500*time.Millisecond)
+		assert.LessOrEqual(t, d, 1500*time.Millisecond)
+	}
+}
+
+func TestRetryPolicyValidate(t *testing.T) {
+	assert.NoError(t, RetryPolicy{}.validate())
+	assert.NoError(t, RetryPolicy{InitialBackoff: time.Second, Multiplier: 1.5, Jitter: 1}.validate())
+	assert.Error(t, RetryPolicy{InitialBackoff: -time.Second}.validate())
+	assert.Error(t, RetryPolicy{Multiplier: 0.5}.validate())
+	assert.Error(t, RetryPolicy{Jitter: 1.5}.validate())
+}
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "network error", err: errors.New("network error"), want: true},
+		{name: "canceled", err: errors.Wrap(context.Canceled, "send request"), want: false},
+		{name: "deadline exceeded", err: context.DeadlineExceeded, want: false},
+		{name: "refused", err: ErrRefused, want: false},
+		{name: "truncated", err: errors.Wrap(ErrTruncated, "partial content"), want: false},
+		{name: "no choices", err: ErrNoChoices, want: true},
+		{name: "unauthorized", err: &APIError{StatusCode: http.StatusUnauthorized}, want: false},
+		{name: "bad request", err: &APIError{StatusCode: http.StatusBadRequest}, want: false},
+		{name: "too many requests", err: &APIError{StatusCode: http.StatusTooManyRequests}, want: true},
+		{name: "service unavailable", err: &APIError{StatusCode: http.StatusServiceUnavailable}, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, retryable(tt.err))
+		})
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, time.Duration(0), parseRetryAfter("", now))
+	assert.Equal(t, 3*time.Second, parseRetryAfter("3", now))
+	assert.Equal(t, 10*time.Second, parseRetryAfter("Wed, 01 Jan 2025 00:00:10 GMT", now))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("Tue, 31 Dec 2024 00:00:00 GMT", now))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("soon", now))
+}
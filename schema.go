@@ -0,0 +1,913 @@
+package llmstructed
+
+import (
+	"bytes"
+	"cmp"
+	"encoding"
+	"encoding/json"
+	"maps"
+	"math"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Schema describes a JSON value, see SchemaProvider.
+type Schema struct {
+	// Type is one of "string", "number", "integer", "boolean", "array" and "object".
+	Type        string
+	Description string
+	// Format is a hint on the format of a string, e.g. "email" or "uuid".
+	Format string
+	// Enum lists the allowed values of a string, number or integer.
+	Enum []string
+	// Minimum and Maximum bound a number or integer.
+	Minimum, Maximum *float64
+	// MinLength, MaxLength and Pattern constrain a string.
+	MinLength, MaxLength *int
+	Pattern              string
+	// MinItems and MaxItems bound the length of an array.
+	MinItems, MaxItems *int
+	// Items is the schema of the elements of an array.
+	Items *Schema
+	// Properties is the schema of the properties of an object.
+	Properties map[string]*Schema
+	// PropertyOrder lists the names of Properties in the order they are generated,
+	// the ones missing from it follow sorted by name.
+	PropertyOrder []string
+	// AdditionalProperties is the schema of the values of an object with free-form keys, i.e. a map.
+	AdditionalProperties *Schema
+	// Optional marks an object property that may be absent, or array items and map values that may be null.
+	Optional bool
+}
+
+// SchemaProvider can be implemented by custom types to provide their own schema, which is used
+// instead of the one derived from the Go type by reflection. Use SchemaOf to post-process it:
+//
+//	func (Invoice) LLMSchema() llmstructed.Schema {
+//		type plain Invoice // Without the LLMSchema method
+//		s, _ := llmstructed.SchemaOf[plain]()
+//		s.Properties["total"].Description = "Total including VAT, e.g. 12.50 EUR"
+//		return s
+//	}
+type SchemaProvider interface {
+	LLMSchema() Schema
+}
+
+// SchemaOf returns the schema of T, as generated for a result or field of type T.
+// Recursive types and JSON Schema fragments of a JSONSchemaProvider cannot be expressed as a Schema.
+func SchemaOf[T any]() (Schema, error) {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	s, err := typeToSchema(t)
+	if err != nil {
+		return Schema{}, err
+	}
+	exported, err := exportSchema(s, s.Defs, nil)
+	if err != nil {
+		return Schema{}, errors.Wrapf(err, "schema of %s", t)
+	}
+	return *exported, nil
+}
+
+// exportSchema converts s to a Schema, inlining the definitions it references.
+// visiting holds the names of the definitions being inlined, to detect recursion.
+func exportSchema(s *schema, defs map[string]*schema, visiting []string) (*Schema, error) {
+	if s.Raw != nil {
+		return nil, errors.New("JSON Schema fragment cannot be expressed as Schema")
+	}
+	if s.Ref != "" {
+		if slices.Contains(visiting, s.Ref) {
+			return nil, errors.Errorf("recursive type %s cannot be expressed as Schema", s.Ref)
+		}
+		def, err := exportSchema(defs[s.Ref], defs, append(visiting, s.Ref))
+		if err != nil {
+			return nil, err
+		}
+		def.Description = firstNonEmpty(s.Description, def.Description)
+		def.Optional = s.Optional
+		return def, nil
+	}
+
+	exported := &Schema{
+		Type:        string(s.Type),
+		Description: s.Description,
+		Format:      s.Format,
+		Enum:        slices.Clone(s.Enum),
+		Minimum:     s.Minimum,
+		Maximum:     s.Maximum,
+		MinLength:   s.MinLength,
+		MaxLength:   s.MaxLength,
+		Pattern:     s.Pattern,
+		MinItems:    s.MinItems,
+		MaxItems:    s.MaxItems,
+		Optional:    s.Optional,
+	}
+	if s.ObjectProperties != nil {
+		exported.PropertyOrder = propertyNames(s)
+	}
+	var err error
+	if s.ArrayItems != nil {
+		if exported.Items, err = exportSchema(s.ArrayItems, defs, visiting); err != nil {
+			return nil, err
+		}
+	}
+	if s.ObjectProperties != nil {
+		exported.Properties = make(map[string]*Schema, len(s.ObjectProperties))
+		for name, property := range s.ObjectProperties {
+			if exported.Properties[name], err = exportSchema(property, defs, visiting); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if s.MapValues != nil {
+		if exported.AdditionalProperties, err = exportSchema(s.MapValues, defs, visiting); err != nil {
+			return nil, err
+		}
+	}
+	return exported, nil
+}
+
+// importSchema converts the Schema s to a schema, checking it can be generated.
+func importSchema(s *Schema, path string) (*schema, error) {
+	if s == nil {
+		return nil, errors.Errorf("%s: missing schema", path)
+	}
+	imported := &schema{
+		Type:        schemaType(s.Type),
+		Description: s.Description,
+		Format:      s.Format,
+		Enum:        slices.Clone(s.Enum),
+		Minimum:     s.Minimum,
+		Maximum:     s.Maximum,
+		MinLength:   s.MinLength,
+		MaxLength:   s.MaxLength,
+		Pattern:     s.Pattern,
+		MinItems:    s.MinItems,
+		MaxItems:    s.MaxItems,
+		Optional:    s.Optional,
+	}
+	var err error
+	switch imported.Type {
+	case schemaTypeString, schemaTypeNumber, schemaTypeInteger, schemaTypeBoolean:
+	case schemaTypeArray:
+		if imported.ArrayItems, err = importSchema(s.Items, path+"[]"); err != nil {
+			return nil, err
+		}
+	case schemaTypeObject:
+		if s.Properties != nil && s.AdditionalProperties != nil {
+			return nil, errors.Errorf("%s: both properties and additional properties", path)
+		}
+		if s.AdditionalProperties != nil {
+			if imported.MapValues, err = importSchema(s.AdditionalProperties, path+".*"); err != nil {
+				return nil, err
+			}
+			break
+		}
+		imported.PropertyOrder = slices.Clone(s.PropertyOrder)
+		imported.ObjectProperties = make(map[string]*schema, len(s.Properties))
+		for name, property := range s.Properties {
+			if imported.ObjectProperties[name], err = importSchema(property, path+"."+name); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		return nil, errors.Errorf("%s: unsupported type: %q", path, s.Type)
+	}
+	if err := checkEnum(imported); err != nil {
+		return nil, errors.Wrap(err, path)
+	}
+	if err := checkConstraints(imported); err != nil {
+		return nil, errors.Wrap(err, path)
+	}
+	return imported, nil
+}
+
+// EnumProvider can be implemented by named string, integer and float types to declare their
+// allowed values once, used as the enum of every field of the type unless overridden by an enum tag, e.g.
+//
+//	type Category string
+//
+//	func (Category) Values() []string {
+//		return []string{"Technology", "Science", "Business"}
+//	}
+//
+// Types implementing encoding.TextUnmarshaler are generated as string enums.
+type EnumProvider interface {
+	Values() []string
+}
+
+// JSONSchemaProvider can be implemented by custom types to supply their own JSON Schema fragment,
+// for keywords a SchemaProvider cannot express. The fragment is used as is, so it must be supported
+// by the provider in strict mode:
+//
+//	func (Money) JSONSchema() json.RawMessage {
+//		return json.RawMessage(`{"type": "string", "pattern": "^[0-9]+\\.[0-9]{2} [A-Z]{3}$"}`)
+//	}
+//
+// Types implementing encoding.TextUnmarshaler are generated as strings without it.
+// Types implementing only json.Unmarshaler require it or a SchemaProvider.
+type JSONSchemaProvider interface {
+	JSONSchema() json.RawMessage
+}
+
+var (
+	schemaProviderType     = reflect.TypeOf((*SchemaProvider)(nil)).Elem()
+	enumProviderType       = reflect.TypeOf((*EnumProvider)(nil)).Elem()
+	jsonSchemaProviderType = reflect.TypeOf((*JSONSchemaProvider)(nil)).Elem()
+	textUnmarshalerType    = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	jsonUnmarshalerType    = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	timeType               = reflect.TypeOf(time.Time{})
+	dateType               = reflect.TypeOf(Date{})
+	durationType           = reflect.TypeOf(time.Duration(0))
+)
+
+// typeToSchema generates the schema of t. Named struct types used more than once or recursively
+// are emitted once in Defs of the returned schema, and referenced by Ref.
+func typeToSchema(t reflect.Type) (*schema, error) {
+	g := &schemaGenerator{
+		defs:  make(map[reflect.Type]*definition),
+		names: make(map[string]reflect.Type),
+	}
+	s, err := g.typeToSchema(t)
+	if err != nil {
+		return nil, err
+	}
+	return g.resolve(s), nil
+}
+
+type schemaGenerator struct {
+	defs  map[reflect.Type]*definition
+	names map[string]reflect.Type
+}
+
+type definition struct {
+	name string
+	// schema is nil while the definition is being generated
+	schema    *schema
+	uses      int
+	recursive bool
+}
+
+func (g *schemaGenerator) typeToSchema(t reflect.Type) (*schema, error) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if reflect.PointerTo(t).Implements(schemaProviderType) {
+		provided := reflect.New(t).Interface().(SchemaProvider).LLMSchema()
+		s, err := importSchema(&provided, "$")
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid schema of %s", t)
+		}
+		return s, nil
+	}
+	if reflect.PointerTo(t).Implements(jsonSchemaProviderType) {
+		return rawSchema(t)
+	}
+
+	switch t {
+	case timeType:
+		return &schema{Type: schemaTypeString, Format: formatDateTime}, nil
+	case dateType:
+		return &schema{Type: schemaTypeString, Format: formatDate}, nil
+	case durationType:
+		// Generated as an ISO 8601 duration, and converted to nanoseconds by normalize
+		return &schema{Type: schemaTypeString, Format: formatDuration}, nil
+	}
+
+	if reflect.PointerTo(t).Implements(enumProviderType) {
+		return enumSchema(t)
+	}
+	// Custom types decoded from strings, such as UUIDs or amounts, whatever their underlying kind
+	if reflect.PointerTo(t).Implements(textUnmarshalerType) {
+		return &schema{Type: schemaTypeString}, nil
+	}
+	// Other custom types decoding their own JSON cannot be reflected
+	if reflect.PointerTo(t).Implements(jsonUnmarshalerType) {
+		return nil, errors.Errorf("%s implements json.Unmarshaler, implement SchemaProvider or JSONSchemaProvider to describe it", t)
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return &schema{Type: schemaTypeString}, nil
+	case reflect.Float32, reflect.Float64:
+		return &schema{Type: schemaTypeNumber}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &schema{Type: schemaTypeInteger}, nil
+	case reflect.Bool:
+		return &schema{Type: schemaTypeBoolean}, nil
+	case reflect.Slice, reflect.Array:
+		s, err := g.typeToSchema(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		s.Optional = s.Optional || t.Elem().Kind() == reflect.Ptr
+		return &schema{
+			Type:       schemaTypeArray,
+			ArrayItems: s,
+		}, nil
+	case reflect.Map:
+		if !isStringLikeKey(t.Key()) {
+			return nil, errors.Errorf("unsupported map key type: %s", t.Key())
+		}
+		s, err := g.typeToSchema(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		s.Optional = s.Optional || t.Elem().Kind() == reflect.Ptr
+		return &schema{
+			Type:      schemaTypeObject,
+			MapValues: s,
+		}, nil
+	case reflect.Struct:
+		if t.Name() != "" {
+			return g.ref(t)
+		}
+		return g.structSchema(t)
+	default:
+		return nil, errors.Errorf("unsupported type: %s", t.Kind())
+	}
+}
+
+// enumSchema returns the schema of t, which implements EnumProvider.
+func enumSchema(t reflect.Type) (*schema, error) {
+	s := &schema{Enum: reflect.New(t).Interface().(EnumProvider).Values()}
+	switch t.Kind() {
+	case reflect.String:
+		s.Type = schemaTypeString
+	case reflect.Float32, reflect.Float64:
+		s.Type = schemaTypeNumber
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		s.Type = schemaTypeInteger
+	}
+	if reflect.PointerTo(t).Implements(textUnmarshalerType) {
+		s.Type = schemaTypeString
+	}
+	if s.Type == "" {
+		return nil, errors.Errorf("enum of unsupported type: %s", t)
+	}
+	if len(s.Enum) == 0 {
+		return nil, errors.Errorf("no enum values of %s", t)
+	}
+	if err := checkEnum(s); err != nil {
+		return nil, errors.Wrapf(err, "enum of %s", t)
+	}
+	return s, nil
+}
+
+// rawSchema returns the schema fragment supplied by t, which implements JSONSchemaProvider.
+func rawSchema(t reflect.Type) (*schema, error) {
+	fragment := reflect.New(t).Interface().(JSONSchemaProvider).JSONSchema()
+	var raw map[string]interface{}
+	if err := json.Unmarshal(fragment, &raw); err != nil {
+		return nil, errors.Wrapf(err, "invalid JSON Schema of %s", t)
+	}
+	s := &schema{Raw: raw}
+	if typ, ok := raw["type"].(string); ok {
+		s.Type = schemaType(typ)
+	}
+	return s, nil
+}
+
+// ref returns a reference to the definition of the named struct type t, generating it on first use.
+func (g *schemaGenerator) ref(t reflect.Type) (*schema, error) {
+	d, ok := g.defs[t]
+	if ok {
+		d.uses++
+		if d.schema == nil {
+			d.recursive = true
+		}
+	} else {
+		d = &definition{name: g.defName(t), uses: 1}
+		g.defs[t] = d
+		s, err := g.structSchema(t)
+		if err != nil {
+			return nil, err
+		}
+		d.schema = s
+	}
+	return &schema{Type: schemaTypeObject, Ref: d.name}, nil
+}
+
+// defName returns a unique definition name for t, based on its type name.
+func (g *schemaGenerator) defName(t reflect.Type) string {
+	base := strings.Map(func(r rune) rune {
+		if r == '_' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' {
+			return r
+		}
+		return '_'
+	}, t.Name())
+	name := base
+	for i := 2; g.names[name] != nil; i++ {
+		name = base + strconv.Itoa(i)
+	}
+	g.names[name] = t
+	return name
+}
+
+func (g *schemaGenerator) structSchema(t reflect.Type) (*schema, error) {
+	properties := make(map[string]*schema)
+	type orderedField struct {
+		name     string
+		position int
+	}
+	var order []orderedField
+	for _, f := range structFields(t) {
+		field := f.field
+		s, err := g.typeToSchema(field.Type)
+		if err != nil {
+			return nil, err
+		}
+		// Keep what a SchemaProvider supplied, unless overridden by tags
+		s.Description = firstNonEmpty(field.Tag.Get("desc"), s.Description)
+		s.Optional = s.Optional || field.Type.Kind() == reflect.Ptr || hasTagOption(f.options, "omitempty") || hasTagOption(f.options, "omitzero")
+		switch s.Type {
+		case schemaTypeString, schemaTypeNumber, schemaTypeInteger:
+			if enumTag := field.Tag.Get("enum"); enumTag != "" {
+				s.Enum = strings.Split(enumTag, ",")
+				if err := checkEnum(s); err != nil {
+					return nil, errors.Wrapf(err, "field %s of %s", field.Name, t)
+				}
+			}
+		}
+		if err := parseConstraintTags(s, field.Tag); err != nil {
+			return nil, errors.Wrapf(err, "field %s of %s", field.Name, t)
+		}
+		properties[f.name] = s
+		position, err := fieldOrder(field)
+		if err != nil {
+			return nil, errors.Wrapf(err, "field %s of %s", field.Name, t)
+		}
+		order = append(order, orderedField{name: f.name, position: position})
+	}
+
+	// Declaration order, unless overridden by order tags
+	slices.SortStableFunc(order, func(a, b orderedField) int {
+		return cmp.Compare(a.position, b.position)
+	})
+	names := make([]string, len(order))
+	for i, f := range order {
+		names[i] = f.name
+	}
+	return &schema{
+		Type:             schemaTypeObject,
+		ObjectProperties: properties,
+		PropertyOrder:    names,
+	}, nil
+}
+
+// fieldOrder returns the position of field given by its order tag, 0 by default.
+// Fields are stably sorted by it, so negative positions come first.
+func fieldOrder(field reflect.StructField) (int, error) {
+	tag, ok := field.Tag.Lookup("order")
+	if !ok {
+		return 0, nil
+	}
+	position, err := strconv.Atoi(tag)
+	if err != nil {
+		return 0, errors.Errorf("invalid order tag: %q", tag)
+	}
+	return position, nil
+}
+
+// propertyNames returns the names of the properties of s in generation order, followed by the ones
+// missing from PropertyOrder, e.g. of a SchemaProvider, sorted by name.
+func propertyNames(s *schema) []string {
+	names := make([]string, 0, len(s.ObjectProperties))
+	for _, name := range s.PropertyOrder {
+		if _, ok := s.ObjectProperties[name]; ok && !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(s.ObjectProperties)) {
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// parseConstraintTags sets the constraints of s from the min, max, minLength, maxLength, pattern,
+// format, minItems and maxItems tags.
+func parseConstraintTags(s *schema, tag reflect.StructTag) error {
+	for _, bound := range []struct {
+		name   string
+		target **float64
+	}{{"min", &s.Minimum}, {"max", &s.Maximum}} {
+		if value, ok := tag.Lookup(bound.name); ok {
+			f, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return errors.Wrapf(err, "invalid %s tag", bound.name)
+			}
+			*bound.target = &f
+		}
+	}
+	for _, bound := range []struct {
+		name   string
+		target **int
+	}{{"minLength", &s.MinLength}, {"maxLength", &s.MaxLength}, {"minItems", &s.MinItems}, {"maxItems", &s.MaxItems}} {
+		if value, ok := tag.Lookup(bound.name); ok {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return errors.Errorf("invalid %s tag: %q", bound.name, value)
+			}
+			*bound.target = &n
+		}
+	}
+	s.Pattern = firstNonEmpty(tag.Get("pattern"), s.Pattern)
+	s.Format = firstNonEmpty(tag.Get("format"), s.Format)
+	return checkConstraints(s)
+}
+
+// checkEnum checks the values of the enum of s are of its type.
+func checkEnum(s *schema) error {
+	if len(s.Enum) == 0 {
+		return nil
+	}
+	switch s.Type {
+	case schemaTypeString:
+	case schemaTypeNumber, schemaTypeInteger:
+		for _, v := range s.Enum {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil || s.Type == schemaTypeInteger && f != math.Trunc(f) {
+				return errors.Errorf("invalid enum value of %s: %q", s.Type, v)
+			}
+		}
+	default:
+		return errors.Errorf("enum only applies to strings, numbers and integers, not %s", s.Type)
+	}
+	return nil
+}
+
+// checkConstraints checks the constraints of s apply to its type.
+func checkConstraints(s *schema) error {
+	numeric := s.Type == schemaTypeNumber || s.Type == schemaTypeInteger
+	switch {
+	case (s.Minimum != nil || s.Maximum != nil) && !numeric:
+		return errors.Errorf("min and max only apply to numbers, not %s", s.Type)
+	case (s.MinLength != nil || s.MaxLength != nil || s.Pattern != "" || s.Format != "") && s.Type != schemaTypeString:
+		return errors.Errorf("minLength, maxLength, pattern and format only apply to strings, not %s", s.Type)
+	case (s.MinItems != nil || s.MaxItems != nil) && s.Type != schemaTypeArray:
+		return errors.Errorf("minItems and maxItems only apply to arrays, not %s", s.Type)
+	case s.Minimum != nil && s.Maximum != nil && *s.Minimum > *s.Maximum,
+		s.MinLength != nil && s.MaxLength != nil && *s.MinLength > *s.MaxLength,
+		s.MinItems != nil && s.MaxItems != nil && *s.MinItems > *s.MaxItems:
+		return errors.New("minimum greater than maximum")
+	}
+	return nil
+}
+
+// hasTagOption reports whether the comma-separated json tag options contain option.
+func hasTagOption(options, option string) bool {
+	for options != "" {
+		var name string
+		name, options, _ = strings.Cut(options, ",")
+		if name == option {
+			return true
+		}
+	}
+	return false
+}
+
+// resolve inlines the definitions used only once, and collects the others into Defs of the root.
+// The root itself is always inlined, since it must not be a reference.
+func (g *schemaGenerator) resolve(root *schema) *schema {
+	byName := make(map[string]*definition, len(g.defs))
+	defs := make(map[string]*schema)
+	for _, d := range g.defs {
+		byName[d.name] = d
+		if d.uses > 1 || d.recursive {
+			defs[d.name] = d.schema
+		}
+	}
+
+	var inline func(s *schema) *schema
+	inline = func(s *schema) *schema {
+		if s.Ref != "" {
+			if _, ok := defs[s.Ref]; ok {
+				return s
+			}
+			// Used only once, so the definition can be modified in place
+			inlined := inline(byName[s.Ref].schema)
+			inlined.Description = firstNonEmpty(s.Description, inlined.Description)
+			inlined.Optional = s.Optional
+			return inlined
+		}
+		if s.ArrayItems != nil {
+			s.ArrayItems = inline(s.ArrayItems)
+		}
+		for name, property := range s.ObjectProperties {
+			s.ObjectProperties[name] = inline(property)
+		}
+		if s.MapValues != nil {
+			s.MapValues = inline(s.MapValues)
+		}
+		return s
+	}
+
+	if root.Ref != "" {
+		body := *byName[root.Ref].schema
+		root = &body
+	}
+	root = inline(root)
+	for name, s := range defs {
+		defs[name] = inline(s)
+	}
+	if len(defs) > 0 {
+		root.Defs = defs
+	}
+	return root
+}
+
+// isStringLikeKey reports whether encoding/json can decode object keys into t.
+func isStringLikeKey(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	default:
+		return reflect.PointerTo(t).Implements(textUnmarshalerType)
+	}
+}
+
+// mapsToKeyValuePairs returns a copy of s with each map replaced by an array of {"key", "value"} objects,
+// and whether any map was replaced.
+func mapsToKeyValuePairs(s *schema) (*schema, bool) {
+	if s.MapValues != nil {
+		values, _ := mapsToKeyValuePairs(s.MapValues)
+		return &schema{
+			Type:          schemaTypeArray,
+			Description:   s.Description,
+			Optional:      s.Optional,
+			KeyValuePairs: true,
+			ArrayItems: &schema{
+				Type: schemaTypeObject,
+				ObjectProperties: map[string]*schema{
+					"key":   {Type: schemaTypeString},
+					"value": values,
+				},
+				PropertyOrder: []string{"key", "value"},
+			},
+		}, true
+	}
+
+	converted := *s
+	var replaced bool
+	if s.ArrayItems != nil {
+		var ok bool
+		converted.ArrayItems, ok = mapsToKeyValuePairs(s.ArrayItems)
+		replaced = replaced || ok
+	}
+	if s.ObjectProperties != nil {
+		converted.ObjectProperties = make(map[string]*schema, len(s.ObjectProperties))
+		for name, property := range s.ObjectProperties {
+			var ok bool
+			converted.ObjectProperties[name], ok = mapsToKeyValuePairs(property)
+			replaced = replaced || ok
+		}
+	}
+	if s.Defs != nil {
+		converted.Defs = make(map[string]*schema, len(s.Defs))
+		for name, def := range s.Defs {
+			var ok bool
+			converted.Defs[name], ok = mapsToKeyValuePairs(def)
+			replaced = replaced || ok
+		}
+	}
+	return &converted, replaced
+}
+
+// needsNormalize reports whether responses of s must be normalized before decoding.
+func needsNormalize(s *schema) bool {
+	if s.KeyValuePairs || s.Format == formatDateTime || s.Format == formatDuration {
+		return true
+	}
+	children := make([]*schema, 0, len(s.ObjectProperties)+len(s.Defs)+2)
+	children = append(children, s.ArrayItems, s.MapValues)
+	for _, property := range s.ObjectProperties {
+		children = append(children, property)
+	}
+	for _, def := range s.Defs {
+		children = append(children, def)
+	}
+	for _, child := range children {
+		if child != nil && needsNormalize(child) {
+			return true
+		}
+	}
+	return false
+}
+
+// normalize rewrites data following s, so that encoding/json can decode it:
+// key/value pairs are converted back into objects, date-times are converted to RFC 3339,
+// and durations are converted to nanoseconds. Values not matching s are left as is, for json.Unmarshal to report.
+func normalize(data []byte, s *schema) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return json.Marshal(normalizeValue(value, s, s.Defs))
+}
+
+func normalizeValue(value any, s *schema, defs map[string]*schema) any {
+	if s.Ref != "" {
+		s = defs[s.Ref]
+	}
+	switch v := value.(type) {
+	case []any:
+		if s.ArrayItems == nil {
+			return v
+		}
+		if s.KeyValuePairs {
+			return restoreKeyValuePairs(v, s, defs)
+		}
+		for i, item := range v {
+			v[i] = normalizeValue(item, s.ArrayItems, defs)
+		}
+		return v
+	case map[string]any:
+		for key, item := range v {
+			if property := lookupProperty(s, key); property != nil {
+				v[key] = normalizeValue(item, property, defs)
+			}
+		}
+		return v
+	case string:
+		switch s.Format {
+		case formatDateTime:
+			if t, ok := parseDateTime(v); ok {
+				return t.Format(time.RFC3339Nano)
+			}
+		case formatDuration:
+			if d, ok := parseDuration(v); ok {
+				return json.Number(strconv.FormatInt(int64(d), 10))
+			}
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+func restoreKeyValuePairs(pairs []any, s *schema, defs map[string]*schema) any {
+	valueSchema := s.ArrayItems.ObjectProperties["value"]
+	m := make(map[string]any, len(pairs))
+	for _, item := range pairs {
+		pair, ok := item.(map[string]any)
+		if !ok {
+			return pairs
+		}
+		key, ok := pair["key"].(string)
+		if !ok {
+			return pairs
+		}
+		m[key] = normalizeValue(pair["value"], valueSchema, defs)
+	}
+	return m
+}
+
+// lookupProperty returns the schema of the object property or map value named key, nil if none.
+// Property names are matched case-insensitively as a fallback, the same as encoding/json does.
+func lookupProperty(s *schema, key string) *schema {
+	if s.MapValues != nil {
+		return s.MapValues
+	}
+	if property, ok := s.ObjectProperties[key]; ok {
+		return property
+	}
+	for name, property := range s.ObjectProperties {
+		if strings.EqualFold(name, key) {
+			return property
+		}
+	}
+	return nil
+}
+
+type structField struct {
+	field   reflect.StructField
+	name    string
+	options string
+	tagged  bool
+	index   []int
+}
+
+// structFields returns the fields of t as seen by encoding/json, in declaration order.
+// Fields of embedded structs are promoted, and conflicting names are resolved the same way:
+// the shallowest field wins, then the only tagged one at that depth, else all of them are dropped.
+func structFields(t reflect.Type) []structField {
+	type embedded struct {
+		typ   reflect.Type
+		index []int
+	}
+
+	var fields []structField
+	visited := map[reflect.Type]bool{}
+	// Number of times each type is embedded at the current and next depth
+	count, nextCount := map[reflect.Type]int{}, map[reflect.Type]int{}
+	for next := []embedded{{typ: t}}; len(next) > 0; {
+		current := next
+		next = nil
+		count, nextCount = nextCount, map[reflect.Type]int{}
+		for _, e := range current {
+			if visited[e.typ] {
+				continue
+			}
+			visited[e.typ] = true
+
+			for i := 0; i < e.typ.NumField(); i++ {
+				sf := e.typ.Field(i)
+				if sf.Anonymous {
+					ft := sf.Type
+					if ft.Kind() == reflect.Ptr {
+						ft = ft.Elem()
+					}
+					// Embedded unexported structs may still have exported fields
+					if !sf.IsExported() && ft.Kind() != reflect.Struct {
+						continue
+					}
+				} else if !sf.IsExported() {
+					continue
+				}
+				jsonTag := sf.Tag.Get("json")
+				if jsonTag == "-" {
+					continue
+				}
+
+				name, options, _ := strings.Cut(jsonTag, ",")
+				index := append(slices.Clone(e.index), i)
+				ft := sf.Type
+				if ft.Name() == "" && ft.Kind() == reflect.Ptr {
+					ft = ft.Elem()
+				}
+				if name == "" && sf.Anonymous && ft.Kind() == reflect.Struct {
+					nextCount[ft]++
+					if nextCount[ft] == 1 {
+						next = append(next, embedded{typ: ft, index: index})
+					}
+					continue
+				}
+
+				f := structField{field: sf, name: name, options: options, tagged: name != "", index: index}
+				if f.name == "" {
+					f.name = sf.Name
+				}
+				fields = append(fields, f)
+				if count[e.typ] > 1 {
+					// The type is embedded more than once at this depth, so its fields conflict and cancel out
+					fields = append(fields, f)
+				}
+			}
+		}
+	}
+
+	// Keep the dominant field of each name
+	byName := make(map[string][]structField)
+	for _, f := range fields {
+		byName[f.name] = append(byName[f.name], f)
+	}
+	dominant := make([]structField, 0, len(byName))
+	for _, candidates := range byName {
+		if f, ok := dominantField(candidates); ok {
+			dominant = append(dominant, f)
+		}
+	}
+	slices.SortFunc(dominant, func(a, b structField) int {
+		return slices.Compare(a.index, b.index)
+	})
+	return dominant
+}
+
+func dominantField(candidates []structField) (structField, bool) {
+	depth := len(candidates[0].index)
+	for _, f := range candidates {
+		depth = min(depth, len(f.index))
+	}
+
+	var shallowest, tagged []structField
+	for _, f := range candidates {
+		if len(f.index) != depth {
+			continue
+		}
+		shallowest = append(shallowest, f)
+		if f.tagged {
+			tagged = append(tagged, f)
+		}
+	}
+	switch {
+	case len(shallowest) == 1:
+		return shallowest[0], true
+	case len(tagged) == 1:
+		return tagged[0], true
+	default:
+		return structField{}, false
+	}
+}
@@ -0,0 +1,556 @@
+package llmstructed
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMapsToKeyValuePairs(t *testing.T) {
+	type Product struct {
+		Name         string            `json:"name"`
+		Translations map[string]string `json:"translations" desc:"name by language"`
+	}
+
+	s, err := typeToSchema(reflect.TypeOf(Product{}))
+	assert.NoError(t, err)
+
+	converted, replaced := mapsToKeyValuePairs(s)
+	assert.True(t, replaced)
+	translations := converted.ObjectProperties["translations"]
+	assert.Equal(t, schemaTypeArray, translations.Type)
+	assert.True(t, translations.KeyValuePairs)
+	assert.Equal(t, "name by language", translations.Description)
+	assert.Equal(t, schemaTypeString, translations.ArrayItems.ObjectProperties["key"].Type)
+	assert.Equal(t, schemaTypeString, translations.ArrayItems.ObjectProperties["value"].Type)
+
+	// The original schema is left unchanged
+	assert.NotNil(t, s.ObjectProperties["translations"].MapValues)
+
+	_, replaced = mapsToKeyValuePairs(&schema{Type: schemaTypeArray, ArrayItems: &schema{Type: schemaTypeString}})
+	assert.False(t, replaced)
+}
+
+func TestNormalizeMaps(t *testing.T) {
+	type Product struct {
+		Name       string                    `json:"name"`
+		Attributes map[string]map[string]int `json:"attributes"`
+	}
+
+	s, err := typeToSchema(reflect.TypeOf(Product{}))
+	assert.NoError(t, err)
+	s, _ = mapsToKeyValuePairs(s)
+
+	data := `{"name":"shirt","attributes":[{"key":"size","value":[{"key":"m","value":1},{"key":"l","value":2}]}]}`
+	restored, err := normalize([]byte(data), s)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"name":"shirt","attributes":{"size":{"m":1,"l":2}}}`, string(restored))
+
+	// Invalid pairs are left for json.Unmarshal to report
+	restored, err = normalize([]byte(`{"attributes":[{"k":"size"}]}`), s)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"attributes":[{"k":"size"}]}`, string(restored))
+}
+
+type timestamps struct {
+	CreatedAt string `json:"created_at"`
+}
+
+func TestStructFields(t *testing.T) {
+	type Base struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	}
+	type Audit struct {
+		ID      string `json:"id"`
+		Comment string
+	}
+	type Tagged struct {
+		Writer string `json:"Author"`
+	}
+	type Other struct {
+		Author string
+	}
+	type Article struct {
+		Base
+		*Audit
+		timestamps
+		Title string `json:"title"`
+		Name  string `json:"name"`
+		Meta  Other  `json:"meta"`
+		Other
+		Tagged
+	}
+
+	var names []string
+	fields := structFields(reflect.TypeOf(Article{}))
+	for _, f := range fields {
+		names = append(names, f.name)
+	}
+	// id conflicts at the same depth and is dropped, name is shadowed by the shallower field,
+	// Author is taken from the only tagged field at its depth
+	assert.Equal(t, []string{"Comment", "created_at", "title", "name", "meta", "Author"}, names)
+	assert.Equal(t, "Writer", fields[5].field.Name)
+
+	s, err := typeToSchema(reflect.TypeOf(Article{}))
+	assert.NoError(t, err)
+	assert.Len(t, s.ObjectProperties, 6)
+	assert.Equal(t, schemaTypeObject, s.ObjectProperties["meta"].Type)
+}
+
+func TestStructFieldsRecursiveEmbedding(t *testing.T) {
+	type Node struct {
+		*Node
+		Value int `json:"value"`
+	}
+
+	fields := structFields(reflect.TypeOf(Node{}))
+	assert.Len(t, fields, 1)
+	assert.Equal(t, "value", fields[0].name)
+}
+
+func TestStructFieldsEmbeddedTwice(t *testing.T) {
+	type C struct {
+		X string
+	}
+	type A struct {
+		C
+		Y string `json:"y"`
+	}
+	type B struct {
+		C
+	}
+	type Outer struct {
+		A
+		B
+	}
+
+	// C is embedded twice at the same depth, so X conflicts with itself and is dropped, as by encoding/json
+	var names []string
+	for _, f := range structFields(reflect.TypeOf(Outer{})) {
+		names = append(names, f.name)
+	}
+	assert.Equal(t, []string{"y"}, names)
+}
+
+type outlineNode struct {
+	Title    string        `json:"title"`
+	Children []outlineNode `json:"children"`
+}
+
+type commentThread struct {
+	Text   string         `json:"text"`
+	Parent *commentThread `json:"parent" desc:"the comment replied to"`
+}
+
+func TestTypeToSchemaDefs(t *testing.T) {
+	type Address struct {
+		City string `json:"city"`
+	}
+	type Order struct {
+		Billing  Address `json:"billing"`
+		Shipping Address `json:"shipping"`
+		Contact  struct {
+			Address Address `json:"address"`
+		} `json:"contact"`
+	}
+	type Profile struct {
+		Home Address `json:"home"`
+	}
+
+	t.Run("shared", func(t *testing.T) {
+		s, err := typeToSchema(reflect.TypeOf(Order{}))
+		assert.NoError(t, err)
+		assert.Equal(t, "Address", s.ObjectProperties["billing"].Ref)
+		assert.Equal(t, "Address", s.ObjectProperties["shipping"].Ref)
+		assert.Equal(t, "Address", s.ObjectProperties["contact"].ObjectProperties["address"].Ref)
+		assert.Len(t, s.Defs, 1)
+		assert.Equal(t, schemaTypeString, s.Defs["Address"].ObjectProperties["city"].Type)
+	})
+
+	t.Run("used once", func(t *testing.T) {
+		s, err := typeToSchema(reflect.TypeOf(Profile{}))
+		assert.NoError(t, err)
+		assert.Empty(t, s.Defs)
+		assert.Empty(t, s.ObjectProperties["home"].Ref)
+		assert.Equal(t, schemaTypeString, s.ObjectProperties["home"].ObjectProperties["city"].Type)
+	})
+
+	t.Run("recursive", func(t *testing.T) {
+		s, err := typeToSchema(reflect.TypeOf(outlineNode{}))
+		assert.NoError(t, err)
+		assert.Empty(t, s.Ref)
+		assert.Equal(t, "outlineNode", s.ObjectProperties["children"].ArrayItems.Ref)
+		assert.Equal(t, "outlineNode", s.Defs["outlineNode"].ObjectProperties["children"].ArrayItems.Ref)
+
+		s, err = typeToSchema(reflect.TypeOf(commentThread{}))
+		assert.NoError(t, err)
+		parent := s.ObjectProperties["parent"]
+		assert.Equal(t, "commentThread", parent.Ref)
+		assert.True(t, parent.Optional)
+		assert.Equal(t, "the comment replied to", parent.Description)
+	})
+}
+
+func TestConvertToOpenAISchemaDefs(t *testing.T) {
+	s, err := typeToSchema(reflect.TypeOf(commentThread{}))
+	assert.NoError(t, err)
+
+	got, err := json.Marshal(convertToOpenAISchema(s, true, false))
+	assert.NoError(t, err)
+	parent := `{"anyOf":[{"$ref":"#/$defs/commentThread"},{"type":"null"}],"description":"the comment replied to"}`
+	assert.JSONEq(t, `{
+		"type": "object",
+		"properties": {"text": {"type": "string"}, "parent": `+parent+`},
+		"required": ["text", "parent"],
+		"additionalProperties": false,
+		"$defs": {
+			"commentThread": {
+				"type": "object",
+				"properties": {"text": {"type": "string"}, "parent": `+parent+`},
+				"required": ["text", "parent"],
+				"additionalProperties": false
+			}
+		}
+	}`, string(got))
+}
+
+// amount implements encoding.TextUnmarshaler, e.g. "12.50 EUR"
+type amount struct {
+	Cents    int64
+	Currency string
+}
+
+func (a *amount) UnmarshalText(text []byte) error {
+	var units, cents int64
+	_, err := fmt.Sscanf(string(text), "%d.%02d %s", &units, &cents, &a.Currency)
+	a.Cents = units*100 + cents
+	return err
+}
+
+// priority implements json.Unmarshaler, and supplies its schema
+type priority int
+
+func (p *priority) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	*p = priority(strings.Count(s, "!"))
+	return nil
+}
+
+func (priority) JSONSchema() json.RawMessage {
+	return json.RawMessage(`{"type": "string", "enum": ["!", "!!", "!!!"]}`)
+}
+
+// decimal implements both encoding.TextUnmarshaler and json.Unmarshaler, like shopspring/decimal
+type decimal struct {
+	text string
+}
+
+func (d *decimal) UnmarshalText(text []byte) error {
+	d.text = string(text)
+	return nil
+}
+
+func (d *decimal) UnmarshalJSON(data []byte) error {
+	return d.UnmarshalText(bytes.Trim(data, `"`))
+}
+
+// score implements only json.Unmarshaler
+type score int
+
+func (s *score) UnmarshalJSON(data []byte) error {
+	return json.Unmarshal(data, (*int)(s))
+}
+
+type invalidSchema struct{}
+
+func (invalidSchema) JSONSchema() json.RawMessage {
+	return json.RawMessage(`{"type":`)
+}
+
+func TestTypeToSchemaCustomTypes(t *testing.T) {
+	type Order struct {
+		Total    amount    `json:"total"`
+		Priority *priority `json:"priority,omitempty" desc:"urgency"`
+	}
+
+	s, err := typeToSchema(reflect.TypeOf(Order{}))
+	assert.NoError(t, err)
+	assert.Equal(t, &schema{Type: schemaTypeString}, s.ObjectProperties["total"])
+	assert.Equal(t, schemaTypeString, s.ObjectProperties["priority"].Type)
+
+	converted := convertToOpenAISchema(s, true, false)
+	properties := converted["properties"].(orderedObject).values
+	assert.Equal(t, map[string]interface{}{"type": schemaTypeString}, properties["total"])
+	assert.Equal(t, map[string]interface{}{
+		"anyOf": []interface{}{
+			map[string]interface{}{"type": "string", "enum": []interface{}{"!", "!!", "!!!"}},
+			map[string]interface{}{"type": schemaTypeNull},
+		},
+		"description": "urgency",
+	}, properties["priority"])
+
+	// The supplied fragment is left unchanged
+	assert.NotContains(t, s.ObjectProperties["priority"].Raw, "description")
+
+	c := &client{llm: &mockLLM{
+		responses: [][]byte{[]byte(`{"total":"12.50 EUR","priority":"!!"}`)},
+		errors:    []error{nil},
+	}}
+	got, err := Get[Order](context.Background(), c, []string{})
+	assert.NoError(t, err)
+	assert.Equal(t, amount{Cents: 1250, Currency: "EUR"}, got.Total)
+	assert.Equal(t, priority(2), *got.Priority)
+
+	_, err = typeToSchema(reflect.TypeOf(invalidSchema{}))
+	assert.ErrorContains(t, err, "invalid JSON Schema")
+
+	// Types implementing both, such as decimals, are strings, but not the ones implementing only json.Unmarshaler
+	s, err = typeToSchema(reflect.TypeOf(decimal{}))
+	assert.NoError(t, err)
+	assert.Equal(t, &schema{Type: schemaTypeString}, s)
+	_, err = typeToSchema(reflect.TypeOf(score(0)))
+	assert.ErrorContains(t, err, "implements json.Unmarshaler")
+}
+
+// invoice post-processes its reflected schema
+type invoice struct {
+	Number string   `json:"number"`
+	Lines  []string `json:"lines" desc:"invoice lines"`
+}
+
+func (invoice) LLMSchema() Schema {
+	type plain invoice
+	s, err := SchemaOf[plain]()
+	if err != nil {
+		panic(err)
+	}
+	s.Description = "an invoice"
+	s.Properties["number"].Format = "invoice-number"
+	return s
+}
+
+type invalidProvidedSchema struct{}
+
+func (invalidProvidedSchema) LLMSchema() Schema {
+	return Schema{Type: "object", Properties: map[string]*Schema{"tags": {Type: "array"}}}
+}
+
+func TestSchemaOf(t *testing.T) {
+	s, err := SchemaOf[*invoice]()
+	assert.NoError(t, err)
+	assert.Equal(t, Schema{
+		Type:        "object",
+		Description: "an invoice",
+		Properties: map[string]*Schema{
+			"number": {Type: "string", Format: "invoice-number"},
+			"lines":  {Type: "array", Description: "invoice lines", Items: &Schema{Type: "string"}},
+		},
+		PropertyOrder: []string{"number", "lines"},
+	}, s)
+
+	// Definitions used more than once are inlined
+	type Order struct {
+		Billing  timestamps            `json:"billing"`
+		Shipping *timestamps           `json:"shipping" desc:"if shipped"`
+		Counts   map[string]timestamps `json:"counts"`
+	}
+	s, err = SchemaOf[Order]()
+	assert.NoError(t, err)
+	assert.Equal(t, "object", s.Properties["billing"].Type)
+	assert.Equal(t, &Schema{Type: "object", Description: "if shipped", Optional: true, Properties: map[string]*Schema{
+		"created_at": {Type: "string"},
+	}, PropertyOrder: []string{"created_at"}}, s.Properties["shipping"])
+	assert.Equal(t, "string", s.Properties["counts"].AdditionalProperties.Properties["created_at"].Type)
+
+	_, err = SchemaOf[outlineNode]()
+	assert.ErrorContains(t, err, "recursive type outlineNode")
+	_, err = SchemaOf[priority]()
+	assert.ErrorContains(t, err, "JSON Schema fragment")
+}
+
+func TestTypeToSchemaProvider(t *testing.T) {
+	type Result struct {
+		Invoice  invoice   `json:"invoice" desc:"the parsed invoice"`
+		Invoices []invoice `json:"invoices"`
+	}
+
+	s, err := typeToSchema(reflect.TypeOf(Result{}))
+	assert.NoError(t, err)
+	assert.Equal(t, "the parsed invoice", s.ObjectProperties["invoice"].Description)
+	assert.Equal(t, "invoice-number", s.ObjectProperties["invoice"].ObjectProperties["number"].Format)
+	assert.Equal(t, "an invoice", s.ObjectProperties["invoices"].ArrayItems.Description)
+
+	_, err = typeToSchema(reflect.TypeOf(invalidProvidedSchema{}))
+	assert.ErrorContains(t, err, "$.tags[]: missing schema")
+	_, err = typeToSchema(reflect.TypeOf(struct {
+		Value invalidProvidedSchema `json:"value"`
+	}{}))
+	assert.ErrorContains(t, err, "invalid schema of llmstructed.invalidProvidedSchema")
+}
+
+func TestConstraintTags(t *testing.T) {
+	type Review struct {
+		Score  int      `json:"score" desc:"quality score" min:"1" max:"10"`
+		Ratio  *float64 `json:"ratio" min:"0.5"`
+		Author string   `json:"author" minLength:"2" maxLength:"20" pattern:"^[a-z]+$"`
+		Email  string   `json:"email" format:"email"`
+		Phone  string   `json:"phone" format:"phone"`
+		Tags   []string `json:"tags" minItems:"1" maxItems:"5"`
+	}
+
+	s, err := typeToSchema(reflect.TypeOf(Review{}))
+	assert.NoError(t, err)
+	one, two, five, twenty := 1, 2, 5, 20
+	half, low, high := 0.5, 1.0, 10.0
+	assert.Equal(t, &schema{Type: schemaTypeInteger, Description: "quality score", Minimum: &low, Maximum: &high}, s.ObjectProperties["score"])
+	assert.Equal(t, &half, s.ObjectProperties["ratio"].Minimum)
+	assert.Equal(t, &schema{Type: schemaTypeString, MinLength: &two, MaxLength: &twenty, Pattern: "^[a-z]+$"}, s.ObjectProperties["author"])
+	assert.Equal(t, "email", s.ObjectProperties["email"].Format)
+	assert.Equal(t, &one, s.ObjectProperties["tags"].MinItems)
+	assert.Equal(t, &five, s.ObjectProperties["tags"].MaxItems)
+
+	// Keywords are used as is in the prompt
+	properties := convertToOpenAISchema(s, false, false)["properties"].(orderedObject).values
+	assert.Equal(t, map[string]interface{}{
+		"type": schemaTypeString, "minLength": &two, "maxLength": &twenty, "pattern": "^[a-z]+$",
+	}, properties["author"])
+
+	// Keywords unsupported by strict structured output are described instead
+	strict, err := json.Marshal(convertToOpenAISchema(s, true, false))
+	assert.NoError(t, err)
+	var converted struct {
+		Properties map[string]map[string]interface{} `json:"properties"`
+	}
+	assert.NoError(t, json.Unmarshal(strict, &converted))
+	assert.Equal(t, map[string]interface{}{
+		"type": "integer", "description": "quality score", "minimum": 1.0, "maximum": 10.0,
+	}, converted.Properties["score"])
+	assert.Equal(t, map[string]interface{}{
+		"type": "string", "description": "(minLength: 2, maxLength: 20)", "pattern": "^[a-z]+$",
+	}, converted.Properties["author"])
+	assert.Equal(t, 1.0, converted.Properties["tags"]["minItems"])
+	assert.Equal(t, map[string]interface{}{"type": "string", "format": "email"}, converted.Properties["email"])
+	assert.Equal(t, map[string]interface{}{"type": "string", "description": `(format: "phone")`}, converted.Properties["phone"])
+
+	for _, field := range []reflect.StructField{
+		{Name: "A", Type: reflect.TypeOf(""), Tag: `min:"1"`},
+		{Name: "A", Type: reflect.TypeOf(0), Tag: `pattern:"^[0-9]$"`},
+		{Name: "A", Type: reflect.TypeOf(""), Tag: `minItems:"1"`},
+		{Name: "A", Type: reflect.TypeOf(0), Tag: `min:"one"`},
+		{Name: "A", Type: reflect.TypeOf(""), Tag: `maxLength:"-1"`},
+		{Name: "A", Type: reflect.TypeOf(0), Tag: `min:"10" max:"1"`},
+	} {
+		_, err := typeToSchema(reflect.StructOf([]reflect.StructField{field}))
+		assert.Error(t, err, field.Tag)
+	}
+}
+
+type category string
+
+func (category) Values() []string {
+	return []string{"food", "tool"}
+}
+
+type level int
+
+func (*level) Values() []string {
+	return []string{"1", "2", "3"}
+}
+
+type badLevel int
+
+func (badLevel) Values() []string {
+	return []string{"low"}
+}
+
+func TestTypeToSchemaEnum(t *testing.T) {
+	type Item struct {
+		Category  category   `json:"category"`
+		Secondary *category  `json:"secondary" enum:"food"`
+		Level     level      `json:"level"`
+		Priority  int        `json:"priority" enum:"1,2,3"`
+		Ratio     float64    `json:"ratio" enum:"0.5,1"`
+		Tags      []category `json:"tags"`
+	}
+
+	s, err := typeToSchema(reflect.TypeOf(Item{}))
+	assert.NoError(t, err)
+	assert.Equal(t, &schema{Type: schemaTypeString, Enum: []string{"food", "tool"}}, s.ObjectProperties["category"])
+	assert.Equal(t, []string{"food"}, s.ObjectProperties["secondary"].Enum)
+	assert.Equal(t, &schema{Type: schemaTypeInteger, Enum: []string{"1", "2", "3"}}, s.ObjectProperties["level"])
+	assert.Equal(t, []string{"1", "2", "3"}, s.ObjectProperties["priority"].Enum)
+	assert.Equal(t, []string{"0.5", "1"}, s.ObjectProperties["ratio"].Enum)
+	assert.Equal(t, []string{"food", "tool"}, s.ObjectProperties["tags"].ArrayItems.Enum)
+
+	// Numeric enums are generated as numbers
+	converted, err := json.Marshal(convertToOpenAISchema(s, true, false))
+	assert.NoError(t, err)
+	assert.Contains(t, string(converted), `"ratio":{"enum":[0.5,1],"type":"number"}`)
+	assert.Contains(t, string(converted), `"secondary":{"enum":["food",null],"type":["string","null"]}`)
+
+	assert.NoError(t, validate([]byte(`{"category":"food","secondary":null,"level":2,"priority":3,"ratio":0.5,"tags":[]}`), s))
+	assert.EqualError(t, validate([]byte(`{"category":"toy","secondary":null,"level":4,"priority":3,"ratio":1.0,"tags":["tool"]}`), s),
+		`$.category: must be one of food, tool, got "toy"; $.level: must be one of 1, 2, 3, got 4`)
+
+	for _, typ := range []reflect.Type{
+		reflect.TypeOf(badLevel(0)),
+		reflect.StructOf([]reflect.StructField{{Name: "A", Type: reflect.TypeOf(0), Tag: `enum:"1.5"`}}),
+		reflect.StructOf([]reflect.StructField{{Name: "A", Type: reflect.TypeOf(0.0), Tag: `enum:"low"`}}),
+	} {
+		_, err := typeToSchema(typ)
+		assert.Error(t, err, typ.String())
+	}
+}
+
+func TestPropertyOrder(t *testing.T) {
+	type Base struct {
+		ID string `json:"id" order:"-1"`
+	}
+	type Answer struct {
+		Answer string `json:"answer"`
+		Base
+		Reasoning string `json:"reasoning" order:"-1"`
+		Sources   []struct {
+			URL   string `json:"url"`
+			Title string `json:"title"`
+		} `json:"sources"`
+		Note *string `json:"note"`
+	}
+
+	s, err := typeToSchema(reflect.TypeOf(Answer{}))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"id", "reasoning", "answer", "sources", "note"}, s.PropertyOrder)
+
+	got, err := json.Marshal(convertToOpenAISchema(s, false, false))
+	assert.NoError(t, err)
+	assert.Equal(t, `{"additionalProperties":false,"properties":{`+
+		`"id":{"type":"string"},"reasoning":{"type":"string"},"answer":{"type":"string"},`+
+		`"sources":{"items":{"additionalProperties":false,"properties":{"url":{"type":"string"},"title":{"type":"string"}},"required":["url","title"],"type":"object"},"type":"array"},`+
+		`"note":{"type":"string"}},`+
+		`"required":["id","reasoning","answer","sources"],"type":"object"}`, string(got))
+
+	converted := convertToOpenAISchema(s, true, true)
+	assert.Equal(t, []string{"id", "reasoning", "answer", "sources", "note"}, converted["propertyOrdering"])
+	assert.Equal(t, []string{"id", "reasoning", "answer", "sources", "note"}, converted["required"])
+
+	// Properties missing from the order, e.g. of a SchemaProvider, follow sorted by name
+	assert.Equal(t, []string{"b", "a", "c"}, propertyNames(&schema{
+		ObjectProperties: map[string]*schema{"a": {}, "b": {}, "c": {}},
+		PropertyOrder:    []string{"b", "missing"},
+	}))
+
+	_, err = typeToSchema(reflect.TypeOf(struct {
+		A string `json:"a" order:"first"`
+	}{}))
+	assert.ErrorContains(t, err, "invalid order tag")
+}
@@ -0,0 +1,346 @@
+package llmstructed
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"iter"
+	"reflect"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// GetStream is a type-safe shortcut for Client.DoStream.
+// It yields a snapshot of the result each time more of it is generated, and the complete result last, e.g.
+//
+//	for summary, err := range llmstructed.GetStream[Summary](ctx, cli, messages) {
+//		if err != nil {
+//			return err
+//		}
+//		render(summary)
+//	}
+//
+// A failed attempt is retried from scratch, so snapshots may start over. Stop iterating to cancel the call.
+func GetStream[T any](ctx context.Context, cli Client, messages []string, opts ...CallOption) iter.Seq2[T, error] {
+	return GetStreamMessages[T](ctx, cli, UserMessages(messages...), opts...)
+}
+
+// GetStreamMessages is a type-safe shortcut for Client.DoStreamMessages.
+func GetStreamMessages[T any](ctx context.Context, cli Client, messages []Message, opts ...CallOption) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		var (
+			ret     T
+			last    T
+			stopped bool
+		)
+		err := cli.DoStreamMessages(ctx, messages, &ret, func() error {
+			last = ret
+			if !yield(ret, nil) {
+				stopped = true
+				return errStopped
+			}
+			return nil
+		}, opts...)
+		switch {
+		case stopped:
+		case err != nil:
+			var zero T
+			yield(zero, err)
+		case !reflect.DeepEqual(ret, last):
+			yield(ret, nil)
+		}
+	}
+}
+
+// Stream asks for a list of T, and yields each item as soon as it is generated,
+// so a pipeline can process the first items before the rest are generated, e.g.
+//
+//	for entity, err := range llmstructed.Stream[Entity](ctx, cli, messages) {
+//		if err != nil {
+//			return err
+//		}
+//		process(entity)
+//	}
+//
+// Each item is yielded once it is complete and valid. A failed attempt is retried as usual before any item
+// is yielded, but once some are, a failure ends the iteration with an error. Stop iterating to cancel the call.
+func Stream[T any](ctx context.Context, cli Client, messages []string, opts ...CallOption) iter.Seq2[T, error] {
+	return StreamMessages[T](ctx, cli, UserMessages(messages...), opts...)
+}
+
+// StreamMessages is like Stream, but with role-aware messages.
+func StreamMessages[T any](ctx context.Context, cli Client, messages []Message, opts ...CallOption) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		var (
+			items   []T
+			yielded int
+			stopped bool
+		)
+		stream := &itemStream{
+			onItem: func(item any) error {
+				if !yield(item.(T), nil) {
+					stopped = true
+					return errStopped
+				}
+				yielded++
+				return nil
+			},
+			abort: func(err error) error {
+				if yielded == 0 {
+					return nil
+				}
+				return errors.WithMessagef(err, "failed after %d items were yielded", yielded)
+			},
+		}
+		// Full slice expression to never overwrite the caller's backing array
+		opts = append(opts[:len(opts):len(opts)], withItemStream(stream))
+		err := cli.DoStreamMessages(ctx, messages, &items, func() error { return nil }, opts...)
+		switch {
+		case stopped:
+		case err != nil:
+			var zero T
+			yield(zero, err)
+		default:
+			// The remaining items, if the client did not stream them
+			for _, item := range items[yielded:] {
+				if !yield(item, nil) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// itemStream receives the items of a list result one by one while it is streamed, see StreamMessages.
+type itemStream struct {
+	// onItem is called with each complete and valid item, in order.
+	onItem func(item any) error
+	// abort is called when an attempt fails, and returns a non-nil error to end the call instead of retrying it.
+	abort func(err error) error
+}
+
+func withItemStream(stream *itemStream) CallOption {
+	return func(o *callOptions) {
+		o.items = stream
+	}
+}
+
+var errStopped = errors.New("iteration stopped")
+
+// callbackError wraps the error returned by the caller's callback, which aborts the call without retrying.
+type callbackError struct {
+	err error
+}
+
+func (e callbackError) Error() string {
+	return e.err.Error()
+}
+
+// partialDecoder returns a handler for streamed content, which decodes the partial content into ret,
+// and calls onUpdate each time the decoded result changes.
+func (e *envelope) partialDecoder(ret reflect.Value, onUpdate func() error) func(content []byte) error {
+	var last []byte
+	return func(content []byte) error {
+		closed, ok := closePartialJSON(content)
+		if !ok || bytes.Equal(closed, last) {
+			return nil
+		}
+		last = closed
+
+		// Decode into a fresh value, so nothing is left over from the previous snapshot
+		fresh := reflect.New(ret.Elem().Type())
+		if err := e.unmarshal(closed, fresh.Interface()); err != nil {
+			// The partial output may not fit the result yet, e.g. a missing envelope key
+			return nil
+		}
+		if reflect.DeepEqual(fresh.Elem().Interface(), ret.Elem().Interface()) {
+			return nil
+		}
+		ret.Elem().Set(fresh.Elem())
+		if err := onUpdate(); err != nil {
+			return callbackError{err: err}
+		}
+		return nil
+	}
+}
+
+// itemDecoder returns a handler for streamed content, which decodes each complete item of the list in ret,
+// and passes it to stream once it is valid. Items after an invalid one are not passed on,
+// as the attempt fails once the response is complete.
+func (e *envelope) itemDecoder(ret reflect.Value, stream *itemStream) func(content []byte) error {
+	itemSchema := *e.schema.ObjectProperties[e.key].ArrayItems
+	itemSchema.Defs = e.schema.Defs
+	itemType := ret.Elem().Type().Elem()
+	var (
+		next    int
+		invalid bool
+	)
+	return func(content []byte) error {
+		items := e.completeItems(content)
+		for ; !invalid && next < len(items); next++ {
+			item := reflect.New(itemType)
+			err := validate(items[next], &itemSchema)
+			if err == nil && e.normalize {
+				items[next], err = normalize(items[next], &itemSchema)
+			}
+			if err == nil {
+				err = json.Unmarshal(items[next], item.Interface())
+			}
+			if err == nil {
+				err = validateResult(item, fmt.Sprintf("%s[%d]", e.path(), next), nil)
+			}
+			if err != nil {
+				invalid = true
+				return nil
+			}
+			if err := stream.onItem(item.Elem().Interface()); err != nil {
+				return callbackError{err: err}
+			}
+		}
+		return nil
+	}
+}
+
+// completeItems returns the items of the list in a prefix of the response, which are complete:
+// objects, arrays and strings once closed, and numbers and literals once followed by another token.
+func (e *envelope) completeItems(content []byte) []json.RawMessage {
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	if token, err := decoder.Token(); err != nil || token != json.Delim('{') {
+		return nil
+	}
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil
+		}
+		if key, _ := token.(string); !strings.EqualFold(key, e.key) {
+			var skipped json.RawMessage
+			if err := decoder.Decode(&skipped); err != nil {
+				return nil
+			}
+			continue
+		}
+
+		if token, err := decoder.Token(); err != nil || token != json.Delim('[') {
+			return nil
+		}
+		var items []json.RawMessage
+		for decoder.More() {
+			var item json.RawMessage
+			if err := decoder.Decode(&item); err != nil {
+				break
+			}
+			// A number or literal at the end of the content may not be complete yet
+			if item[0] != '{' && item[0] != '[' && item[0] != '"' && decoder.InputOffset() == int64(len(content)) {
+				break
+			}
+			items = append(items, item)
+		}
+		return items
+	}
+	return nil
+}
+
+// closePartialJSON turns a prefix of a JSON document into a valid document, by dropping the trailing
+// incomplete key, number or literal, and closing the open strings, arrays and objects.
+// Incomplete string values are kept, so long texts can be rendered while they are generated.
+func closePartialJSON(data []byte) ([]byte, bool) {
+	type frame struct {
+		closer    byte
+		expectKey bool
+	}
+	var (
+		stack []frame
+		// data[:safe] followed by safeClosers is a valid document
+		safe        = -1
+		safeClosers []byte
+	)
+	closers := func() []byte {
+		b := make([]byte, 0, len(stack))
+		for i := len(stack) - 1; i >= 0; i-- {
+			b = append(b, stack[i].closer)
+		}
+		return b
+	}
+	closeAtSafe := func() ([]byte, bool) {
+		if safe < 0 {
+			return nil, false
+		}
+		closed := append(bytes.Clone(data[:safe]), safeClosers...)
+		return closed, json.Valid(closed)
+	}
+	inObject := func() bool {
+		return len(stack) > 0 && stack[len(stack)-1].closer == '}'
+	}
+
+	for i := 0; i < len(data); {
+		switch c := data[i]; c {
+		case ' ', '\t', '\n', '\r', ':':
+			i++
+		case ',':
+			if inObject() {
+				stack[len(stack)-1].expectKey = true
+			}
+			i++
+		case '{', '[':
+			closer := byte(']')
+			if c == '{' {
+				closer = '}'
+			}
+			stack = append(stack, frame{closer: closer, expectKey: c == '{'})
+			i++
+			safe, safeClosers = i, closers()
+		case '}', ']':
+			if len(stack) == 0 || stack[len(stack)-1].closer != c {
+				return nil, false
+			}
+			stack = stack[:len(stack)-1]
+			i++
+			safe, safeClosers = i, closers()
+		case '"':
+			isKey := inObject() && stack[len(stack)-1].expectKey
+			end := i + 1
+			for end < len(data) && data[end] != '"' {
+				if data[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end < len(data) {
+				i = end + 1
+				if isKey {
+					stack[len(stack)-1].expectKey = false
+				} else {
+					safe, safeClosers = i, closers()
+				}
+				continue
+			}
+			if isKey {
+				return closeAtSafe()
+			}
+			// Close the incomplete string value, dropping a trailing incomplete escape sequence if any
+			for trim := 0; trim <= len(`\uXXX`) && len(data)-trim > i; trim++ {
+				closed := append(append(bytes.Clone(data[:len(data)-trim]), '"'), closers()...)
+				if json.Valid(closed) {
+					return closed, true
+				}
+			}
+			return closeAtSafe()
+		default:
+			// Numbers and literals, only complete once followed by another token
+			end := i
+			for end < len(data) && bytes.IndexByte([]byte(" \t\n\r,:{}[]\""), data[end]) == -1 {
+				end++
+			}
+			if end == len(data) {
+				return closeAtSafe()
+			}
+			i = end
+			safe, safeClosers = i, closers()
+		}
+	}
+
+	return closeAtSafe()
+}
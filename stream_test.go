@@ -0,0 +1,305 @@
+package llmstructed
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClosePartialJSON(t *testing.T) {
+	tests := []struct {
+		partial string
+		want    string
+		wantOK  bool
+	}{
+		{partial: ``, wantOK: false},
+		{partial: `{`, want: `{}`, wantOK: true},
+		{partial: `{"ti`, want: `{}`, wantOK: true},
+		{partial: `{"title"`, want: `{}`, wantOK: true},
+		{partial: `{"title": `, want: `{}`, wantOK: true},
+		{partial: `{"title": "Hel`, want: `{"title": "Hel"}`, wantOK: true},
+		{partial: `{"title": "Hello\`, want: `{"title": "Hello"}`, wantOK: true},
+		{partial: `{"title": "Hello \u00`, want: `{"title": "Hello "}`, wantOK: true},
+		{partial: `{"title": "Hello", "score": 1`, want: `{"title": "Hello"}`, wantOK: true},
+		{partial: `{"title": "Hello", "score": 10,`, want: `{"title": "Hello", "score": 10}`, wantOK: true},
+		{partial: `{"ok": tr`, want: `{}`, wantOK: true},
+		{partial: `{"tags": ["a", "b`, want: `{"tags": ["a", "b"]}`, wantOK: true},
+		{partial: `{"items": [{"name": "a"}, {"na`, want: `{"items": [{"name": "a"}, {}]}`, wantOK: true},
+		{partial: `{"title": "a{b}[c]"}`, want: `{"title": "a{b}[c]"}`, wantOK: true},
+		{partial: `{"title": "x"]`, wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.partial, func(t *testing.T) {
+			got, ok := closePartialJSON([]byte(tt.partial))
+			assert.Equal(t, tt.wantOK, ok)
+			if tt.wantOK {
+				assert.Equal(t, tt.want, string(got))
+			}
+		})
+	}
+}
+
+func TestDoStream(t *testing.T) {
+	type TestResponse struct {
+		Title string   `json:"title"`
+		Tags  []string `json:"tags"`
+	}
+
+	t.Run("snapshots", func(t *testing.T) {
+		c := &client{llm: &mockLLM{
+			responses: [][]byte{[]byte(`{"title":"Hi","tags":["a","b"]}`)},
+			errors:    []error{nil},
+		}}
+
+		var got []TestResponse
+		for resp, err := range GetStream[TestResponse](context.Background(), c, []string{"test message"}) {
+			if err != nil {
+				t.Fatalf("GetStream() error = %v", err)
+			}
+			got = append(got, resp)
+		}
+
+		want := []TestResponse{
+			{Title: "H"},
+			{Title: "Hi"},
+			{Title: "Hi", Tags: []string{}},
+			{Title: "Hi", Tags: []string{""}},
+			{Title: "Hi", Tags: []string{"a"}},
+			{Title: "Hi", Tags: []string{"a", ""}},
+			{Title: "Hi", Tags: []string{"a", "b"}},
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("GetStream() = %#v, want %#v", got, want)
+		}
+	})
+
+	t.Run("messages", func(t *testing.T) {
+		mockLLM := &mockLLM{
+			responses: [][]byte{[]byte(`{"title":"Hi","tags":[]}`)},
+			errors:    []error{nil},
+		}
+		c := &client{llm: mockLLM}
+
+		messages := []Message{{Role: RoleSystem, Content: "be brief"}, {Role: RoleUser, Content: "test message"}}
+		var last TestResponse
+		for resp, err := range GetStreamMessages[TestResponse](context.Background(), c, messages) {
+			if err != nil {
+				t.Fatalf("GetStreamMessages() error = %v", err)
+			}
+			last = resp
+		}
+		if last.Title != "Hi" {
+			t.Errorf("GetStreamMessages() = %#v, want title Hi", last)
+		}
+		if !reflect.DeepEqual(mockLLM.lastMessages, messages) {
+			t.Errorf("messages = %v, want %v", mockLLM.lastMessages, messages)
+		}
+	})
+
+	t.Run("stop iterating", func(t *testing.T) {
+		mockLLM := &mockLLM{
+			responses: [][]byte{[]byte(`{"title":"Hi","tags":["a","b"]}`), []byte(`{"title":"Hi"}`)},
+			errors:    []error{nil, nil},
+		}
+		c := &client{llm: mockLLM, retry: 1}
+
+		for range GetStream[TestResponse](context.Background(), c, []string{"test message"}) {
+			break
+		}
+		if mockLLM.calls != 1 {
+			t.Errorf("calls = %d, want 1", mockLLM.calls)
+		}
+	})
+
+	t.Run("callback error", func(t *testing.T) {
+		c := &client{llm: &mockLLM{
+			responses: [][]byte{[]byte(`{"title":"Hi"}`)},
+			errors:    []error{nil},
+		}}
+
+		errRender := errors.New("render failed")
+		var got TestResponse
+		err := c.DoStream(context.Background(), []string{"test message"}, &got, func() error { return errRender })
+		if err != errRender {
+			t.Errorf("DoStream() error = %v, want %v", err, errRender)
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		c := &client{llm: &mockLLM{
+			responses: [][]byte{nil},
+			errors:    []error{errors.New("network error")},
+		}}
+
+		var errs []error
+		for _, err := range GetStream[TestResponse](context.Background(), c, []string{"test message"}) {
+			errs = append(errs, err)
+		}
+		if len(errs) != 1 || errs[0] == nil {
+			t.Errorf("GetStream() errors = %v, want a single error", errs)
+		}
+	})
+}
+
+func TestStreamItems(t *testing.T) {
+	type Entity struct {
+		Name string `json:"name"`
+	}
+
+	t.Run("items", func(t *testing.T) {
+		mockLLM := &mockLLM{
+			responses: [][]byte{[]byte(`{"values":[{"name":"a"},{"name":"b"},{"name":"c"}]}`)},
+			errors:    []error{nil},
+		}
+		c := &client{llm: mockLLM}
+
+		var got []Entity
+		for entity, err := range Stream[Entity](context.Background(), c, []string{"test message"}) {
+			if err != nil {
+				t.Fatalf("Stream() error = %v", err)
+			}
+			if len(got) == 0 && mockLLM.calls != 0 {
+				t.Error("first item yielded after the response is complete, want while streaming")
+			}
+			got = append(got, entity)
+		}
+		if want := []Entity{{Name: "a"}, {Name: "b"}, {Name: "c"}}; !reflect.DeepEqual(got, want) {
+			t.Errorf("Stream() = %v, want %v", got, want)
+		}
+	})
+
+	t.Run("primitives", func(t *testing.T) {
+		c := &client{llm: &mockLLM{
+			responses: [][]byte{[]byte(`{"values":[10,20,30]}`)},
+			errors:    []error{nil},
+		}}
+
+		var got []int
+		for n, err := range Stream[int](context.Background(), c, []string{"test message"}) {
+			if err != nil {
+				t.Fatalf("Stream() error = %v", err)
+			}
+			got = append(got, n)
+		}
+		if want := []int{10, 20, 30}; !reflect.DeepEqual(got, want) {
+			t.Errorf("Stream() = %v, want %v", got, want)
+		}
+	})
+
+	t.Run("retry before items are yielded", func(t *testing.T) {
+		c := &client{llm: &mockLLM{
+			responses: [][]byte{[]byte(`{"values":[{"name":1},{"name":"b"}]}`), []byte(`{"values":[{"name":"x"},{"name":"y"}]}`)},
+			errors:    []error{nil, nil},
+		}, repair: 1}
+
+		var got []Entity
+		for entity, err := range Stream[Entity](context.Background(), c, []string{"test message"}) {
+			if err != nil {
+				t.Fatalf("Stream() error = %v", err)
+			}
+			got = append(got, entity)
+		}
+		if want := []Entity{{Name: "x"}, {Name: "y"}}; !reflect.DeepEqual(got, want) {
+			t.Errorf("Stream() = %v, want %v", got, want)
+		}
+	})
+
+	t.Run("failure after items are yielded", func(t *testing.T) {
+		mockLLM := &mockLLM{
+			responses: [][]byte{[]byte(`{"values":[{"name":"a"},{"name":"b"},{"name":3}]}`), []byte(`{"values":[{"name":"x"},{"name":"y"},{"name":"z"}]}`)},
+			errors:    []error{nil, nil},
+		}
+		c := &client{llm: mockLLM, repair: 1}
+
+		var (
+			got  []Entity
+			errs []error
+		)
+		for entity, err := range Stream[Entity](context.Background(), c, []string{"test message"}) {
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			got = append(got, entity)
+		}
+		if want := []Entity{{Name: "a"}, {Name: "b"}}; !reflect.DeepEqual(got, want) {
+			t.Errorf("Stream() = %v, want %v", got, want)
+		}
+		var decodeErr *DecodeError
+		if len(errs) != 1 || !errors.As(errs[0], &decodeErr) {
+			t.Errorf("Stream() errors = %v, want a single DecodeError", errs)
+		}
+		if mockLLM.calls != 1 {
+			t.Errorf("calls = %d, want 1", mockLLM.calls)
+		}
+	})
+
+	t.Run("options left untouched", func(t *testing.T) {
+		c := &client{llm: &mockLLM{
+			responses: [][]byte{[]byte(`{"values":[{"name":"a"}]}`)},
+			errors:    []error{nil},
+		}}
+
+		opts := make([]CallOption, 1, 2)
+		opts[0] = WithSeed(1)
+		for _, err := range Stream[Entity](context.Background(), c, []string{"test message"}, opts...) {
+			if err != nil {
+				t.Fatalf("Stream() error = %v", err)
+			}
+		}
+		if spare := opts[:2][1]; spare != nil {
+			t.Error("Stream() wrote into the spare capacity of the options")
+		}
+	})
+
+	t.Run("stop iterating", func(t *testing.T) {
+		mockLLM := &mockLLM{
+			responses: [][]byte{[]byte(`{"values":[{"name":"a"},{"name":"b"}]}`)},
+			errors:    []error{nil},
+		}
+		c := &client{llm: mockLLM}
+
+		var got []Entity
+		for entity := range Stream[Entity](context.Background(), c, []string{"test message"}) {
+			got = append(got, entity)
+			break
+		}
+		if want := []Entity{{Name: "a"}}; !reflect.DeepEqual(got, want) {
+			t.Errorf("Stream() = %v, want %v", got, want)
+		}
+	})
+}
+
+func TestCompleteItems(t *testing.T) {
+	env := &envelope{key: "values"}
+	tests := []struct {
+		partial string
+		want    []string
+	}{
+		{partial: `{"values":[`, want: nil},
+		{partial: `{"values":[{"name":"a"`, want: nil},
+		{partial: `{"values":[{"name":"a"}`, want: []string{`{"name":"a"}`}},
+		{partial: `{"values":[{"name":"a"},{"name":"b"}]}`, want: []string{`{"name":"a"}`, `{"name":"b"}`}},
+		{partial: `{"values":[["a"],["b"`, want: []string{`["a"]`}},
+		{partial: `{"values":["a","b`, want: []string{`"a"`}},
+		{partial: `{"values":[10,20`, want: []string{`10`}},
+		{partial: `{"values":[10,20]`, want: []string{`10`, `20`}},
+		{partial: `{"values":[true,fal`, want: []string{`true`}},
+		{partial: `{"chain_of_thought":"[{}]","values":[{}`, want: []string{`{}`}},
+		{partial: `{"chain_of_thought":"[{}`, want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.partial, func(t *testing.T) {
+			var got []string
+			for _, item := range env.completeItems([]byte(tt.partial)) {
+				got = append(got, string(item))
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package llmstructed
+
+// Usage is the number of tokens consumed by the model.
+type Usage struct {
+	// PromptTokens includes CachedTokens.
+	PromptTokens int
+	// CompletionTokens includes ReasoningTokens.
+	CompletionTokens int
+	// CachedTokens is the number of prompt tokens served from the provider prompt cache.
+	CachedTokens int
+	// ReasoningTokens is the number of tokens spent on reasoning by reasoning models.
+	ReasoningTokens int
+}
+
+// TotalTokens is the sum of prompt and completion tokens.
+func (u Usage) TotalTokens() int {
+	return u.PromptTokens + u.CompletionTokens
+}
+
+func (u *Usage) add(other Usage) {
+	u.PromptTokens += other.PromptTokens
+	u.CompletionTokens += other.CompletionTokens
+	u.CachedTokens += other.CachedTokens
+	u.ReasoningTokens += other.ReasoningTokens
+}
+
+// Price is the price of a model per million tokens, in any currency.
+type Price struct {
+	Prompt float64
+	// CachedPrompt applies to cached prompt tokens.
+	// Default: Prompt
+	CachedPrompt float64
+	Completion   float64
+}
+
+func (p Price) cost(u Usage) float64 {
+	cachedPrompt := p.CachedPrompt
+	if cachedPrompt == 0 {
+		cachedPrompt = p.Prompt
+	}
+	return (float64(u.PromptTokens-u.CachedTokens)*p.Prompt +
+		float64(u.CachedTokens)*cachedPrompt +
+		float64(u.CompletionTokens)*p.Completion) / 1e6
+}
+
+// Metadata reports details of a single call, see WithMetadata.
+type Metadata struct {
+	// Usage is accumulated across retries and repair rounds.
+	Usage Usage
+	// Cost is estimated from Config.Prices, zero if the model has no price.
+	Cost float64
+	// Requests is the number of requests sent, including retries and repair rounds.
+	Requests int
+	// ChainOfThought is the reasoning generated before the result of the last response,
+	// when Config.ChainOfThought is enabled.
+	ChainOfThought string
+	// Reasoning is the reasoning of reasoning models in the last response, such as deepseek-reasoner,
+	// reported separately or in a <think> block.
+	Reasoning string
+}
+
+func (m *Metadata) add(resp *completion, prices map[string]Price) {
+	m.Requests++
+	if resp == nil {
+		return
+	}
+	m.Reasoning = resp.reasoning
+	m.Usage.add(resp.usage)
+	m.Cost += prices[resp.model].cost(resp.usage)
+}
+
+// Stats is accumulated over all calls of a Client.
+type Stats struct {
+	Usage Usage
+	// Cost is estimated from Config.Prices.
+	Cost     float64
+	Requests int
+}
@@ -0,0 +1,15 @@
+package llmstructed
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPriceCost(t *testing.T) {
+	usage := Usage{PromptTokens: 1_000_000, CompletionTokens: 500_000, CachedTokens: 400_000}
+
+	assert.InDelta(t, 0.6*2+0.4*2+0.5*8, Price{Prompt: 2, Completion: 8}.cost(usage), 1e-9)
+	assert.InDelta(t, 0.6*2+0.4*0.5+0.5*8, Price{Prompt: 2, CachedPrompt: 0.5, Completion: 8}.cost(usage), 1e-9)
+	assert.Zero(t, Price{}.cost(usage))
+}
@@ -0,0 +1,276 @@
+package llmstructed
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"math"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// validate checks the JSON document data against s, since nothing guarantees the model output
+// matches the schema without strict structured output, and json.Unmarshal tolerates most mismatches.
+// It returns a *ValidationError listing every violation, or the syntax error if data is not JSON.
+func validate(data []byte, s *schema) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return err
+	}
+
+	v := &validator{defs: s.Defs}
+	v.validate("$", value, s)
+	if len(v.violations) > 0 {
+		return &ValidationError{Violations: v.violations}
+	}
+	return nil
+}
+
+type validator struct {
+	defs       map[string]*schema
+	violations []Violation
+}
+
+func (v *validator) report(path, format string, args ...any) {
+	v.violations = append(v.violations, Violation{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) validate(path string, value any, s *schema) {
+	if value == nil {
+		if !s.Optional {
+			v.report(path, "must not be null")
+		}
+		return
+	}
+	if s.Ref != "" {
+		s = v.defs[s.Ref]
+	}
+	if s.Raw != nil {
+		// Fragments supplied by a JSONSchemaProvider are left to the type to check
+		return
+	}
+
+	switch s.Type {
+	case schemaTypeString:
+		str, ok := value.(string)
+		if !ok {
+			v.reportType(path, value, s.Type)
+			return
+		}
+		v.validateString(path, str, s)
+	case schemaTypeNumber, schemaTypeInteger:
+		n, ok := value.(json.Number)
+		if !ok {
+			v.reportType(path, value, s.Type)
+			return
+		}
+		v.validateNumber(path, n, s)
+	case schemaTypeBoolean:
+		if _, ok := value.(bool); !ok {
+			v.reportType(path, value, s.Type)
+		}
+	case schemaTypeArray:
+		items, ok := value.([]any)
+		if !ok {
+			v.reportType(path, value, s.Type)
+			return
+		}
+		if s.MinItems != nil && len(items) < *s.MinItems {
+			v.report(path, "must have at least %d items", *s.MinItems)
+		}
+		if s.MaxItems != nil && len(items) > *s.MaxItems {
+			v.report(path, "must have at most %d items", *s.MaxItems)
+		}
+		for i, item := range items {
+			v.validate(fmt.Sprintf("%s[%d]", path, i), item, s.ArrayItems)
+		}
+	case schemaTypeObject:
+		object, ok := value.(map[string]any)
+		if !ok {
+			v.reportType(path, value, s.Type)
+			return
+		}
+		v.validateObject(path, object, s)
+	}
+}
+
+func (v *validator) validateString(path, str string, s *schema) {
+	if len(s.Enum) > 0 && !slices.Contains(s.Enum, str) {
+		v.report(path, "must be one of %s, got %q", strings.Join(s.Enum, ", "), str)
+	}
+	if s.MinLength != nil && utf8.RuneCountInString(str) < *s.MinLength {
+		v.report(path, "must be at least %d characters long", *s.MinLength)
+	}
+	if s.MaxLength != nil && utf8.RuneCountInString(str) > *s.MaxLength {
+		v.report(path, "must be at most %d characters long", *s.MaxLength)
+	}
+	// Patterns are meant for ECMAScript, those RE2 doesn't support are left unchecked
+	if re, err := regexp.Compile(s.Pattern); s.Pattern != "" && err == nil && !re.MatchString(str) {
+		v.report(path, "must match %s", s.Pattern)
+	}
+
+	var ok bool
+	switch s.Format {
+	case formatDateTime:
+		_, ok = parseDateTime(str)
+	case formatDate:
+		_, err := ParseDate(str)
+		ok = err == nil || str == ""
+	case formatDuration:
+		_, ok = parseDuration(str)
+	default:
+		ok = true
+	}
+	if !ok {
+		v.report(path, "must be a %s, got %q", s.Format, str)
+	}
+}
+
+func (v *validator) validateNumber(path string, n json.Number, s *schema) {
+	f, err := n.Float64()
+	if err != nil {
+		v.report(path, "must be %s %s, got %s", article(s.Type), s.Type, n)
+		return
+	}
+	if s.Type == schemaTypeInteger && f != math.Trunc(f) {
+		v.report(path, "must be an integer, got %s", n)
+	}
+	if len(s.Enum) > 0 && !slices.ContainsFunc(s.Enum, func(value string) bool {
+		allowed, err := strconv.ParseFloat(value, 64)
+		return err == nil && allowed == f
+	}) {
+		v.report(path, "must be one of %s, got %s", strings.Join(s.Enum, ", "), n)
+	}
+	if s.Minimum != nil && f < *s.Minimum {
+		v.report(path, "must be at least %v, got %s", *s.Minimum, n)
+	}
+	if s.Maximum != nil && f > *s.Maximum {
+		v.report(path, "must be at most %v, got %s", *s.Maximum, n)
+	}
+}
+
+func (v *validator) validateObject(path string, object map[string]any, s *schema) {
+	// Sorted, so violations are reported in a stable order
+	keys := slices.Sorted(maps.Keys(object))
+	for _, key := range keys {
+		property := lookupProperty(s, key)
+		if property == nil {
+			v.report(path+"."+key, "unexpected property")
+			continue
+		}
+		v.validate(path+"."+key, object[key], property)
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(s.ObjectProperties)) {
+		if s.ObjectProperties[name].Optional {
+			continue
+		}
+		present := slices.ContainsFunc(keys, func(key string) bool {
+			return strings.EqualFold(key, name)
+		})
+		if !present {
+			v.report(path+"."+name, "missing required property")
+		}
+	}
+}
+
+func (v *validator) reportType(path string, value any, want schemaType) {
+	got := "null"
+	switch value.(type) {
+	case string:
+		got = "string"
+	case json.Number:
+		got = "number"
+	case bool:
+		got = "boolean"
+	case []any:
+		got = "array"
+	case map[string]any:
+		got = "object"
+	}
+	v.report(path, "must be %s %s, got %s", article(want), want, got)
+}
+
+func article(t schemaType) string {
+	if t == schemaTypeInteger || t == schemaTypeObject || t == schemaTypeArray {
+		return "an"
+	}
+	return "a"
+}
+
+// Validator can be implemented by results, and by the structs, slices and maps nested in them, to check
+// rules the schema cannot express, e.g. an end date after the start date. Failures are reported as
+// a ValidationError, so the response is retried or repaired the same way as one not matching the schema.
+type Validator interface {
+	Validate() error
+}
+
+var validatorType = reflect.TypeOf((*Validator)(nil)).Elem()
+
+// validateResult calls the Validate methods of the decoded result v and its nested values,
+// innermost first, then the validate function of the Config if any and v points to a struct.
+func validateResult(v reflect.Value, root string, validate func(ret any) error) error {
+	var violations []Violation
+	walkValidators(v.Elem(), root, &violations)
+	if validate != nil && v.Elem().Kind() == reflect.Struct {
+		if err := validate(v.Interface()); err != nil {
+			violations = append(violations, Violation{Path: root, Message: err.Error()})
+		}
+	}
+	if len(violations) > 0 {
+		return &ValidationError{Violations: violations}
+	}
+	return nil
+}
+
+func walkValidators(v reflect.Value, path string, violations *[]Violation) {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !v.IsNil() {
+			walkValidators(v.Elem(), path, violations)
+		}
+		return
+	case reflect.Struct:
+		for _, f := range structFields(v.Type()) {
+			// Fields promoted through a nil embedded pointer are absent
+			if field, err := v.FieldByIndexErr(f.index); err == nil {
+				walkValidators(field, path+"."+f.name, violations)
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			walkValidators(v.Index(i), fmt.Sprintf("%s[%d]", path, i), violations)
+		}
+	case reflect.Map:
+		keys := v.MapKeys()
+		slices.SortFunc(keys, func(a, b reflect.Value) int {
+			return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+		})
+		for _, key := range keys {
+			// Map values are not addressable, so copied for pointer receivers
+			value := reflect.New(v.Type().Elem()).Elem()
+			value.Set(v.MapIndex(key))
+			walkValidators(value, fmt.Sprintf("%s.%v", path, key), violations)
+		}
+	}
+
+	var validator Validator
+	switch {
+	case v.CanAddr() && v.Addr().Type().Implements(validatorType):
+		validator = v.Addr().Interface().(Validator)
+	case v.Type().Implements(validatorType) && v.CanInterface():
+		validator = v.Interface().(Validator)
+	default:
+		return
+	}
+	if err := validator.Validate(); err != nil {
+		*violations = append(*violations, Violation{Path: path, Message: err.Error()})
+	}
+}
@@ -0,0 +1,248 @@
+package llmstructed
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	type Item struct {
+		Name     string   `json:"name" minLength:"2"`
+		Category string   `json:"category" enum:"food,tool"`
+		Price    *float64 `json:"price" min:"0"`
+	}
+	type Order struct {
+		ID     int             `json:"id" max:"100"`
+		Paid   bool            `json:"paid"`
+		Items  []Item          `json:"items" maxItems:"2"`
+		Due    Date            `json:"due,omitempty"`
+		Code   string          `json:"code,omitempty" pattern:"^[A-Z]+$"`
+		Labels map[string]int  `json:"labels,omitempty"`
+		Next   *outlineNode    `json:"next"`
+		Picks  []*Item         `json:"picks,omitempty"`
+		Stock  map[string]*int `json:"stock,omitempty"`
+	}
+
+	s, err := typeToSchema(reflect.TypeOf(Order{}))
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name string
+		data string
+		want []Violation
+	}{
+		{
+			name: "valid",
+			data: `{"id":1,"paid":true,"items":[{"name":"apple","category":"food","price":null}],"labels":{"a":1},"next":null,"Code":"AB",
+				"picks":[null,{"name":"saw","category":"tool","price":null}],"stock":{"a":null,"b":1}}`,
+		},
+		{
+			name: "missing and unexpected properties",
+			data: `{"id":1,"items":[],"next":null,"extra":true}`,
+			want: []Violation{
+				{Path: "$.extra", Message: "unexpected property"},
+				{Path: "$.paid", Message: "missing required property"},
+			},
+		},
+		{
+			name: "wrong types",
+			data: `{"id":1.5,"paid":"yes","items":{},"next":null,"labels":{"a":"b"}}`,
+			want: []Violation{
+				{Path: "$.id", Message: "must be an integer, got 1.5"},
+				{Path: "$.items", Message: "must be an array, got object"},
+				{Path: "$.labels.a", Message: "must be an integer, got string"},
+				{Path: "$.paid", Message: "must be a boolean, got string"},
+			},
+		},
+		{
+			name: "constraints",
+			data: `{"id":101,"paid":false,"due":"soon","code":"ab","next":null,"items":[
+				{"name":"a","category":"toy","price":-1},{"name":"bb","category":"food","price":1},{"name":"cc","category":"tool"}]}`,
+			want: []Violation{
+				{Path: "$.code", Message: "must match ^[A-Z]+$"},
+				{Path: "$.due", Message: `must be a date, got "soon"`},
+				{Path: "$.id", Message: "must be at most 100, got 101"},
+				{Path: "$.items", Message: "must have at most 2 items"},
+				{Path: "$.items[0].category", Message: `must be one of food, tool, got "toy"`},
+				{Path: "$.items[0].name", Message: "must be at least 2 characters long"},
+				{Path: "$.items[0].price", Message: "must be at least 0, got -1"},
+			},
+		},
+		{
+			name: "null and references",
+			data: `{"id":null,"paid":true,"items":[null],"next":{"title":1,"children":[]}}`,
+			want: []Violation{
+				{Path: "$.id", Message: "must not be null"},
+				{Path: "$.items[0]", Message: "must not be null"},
+				{Path: "$.next.title", Message: "must be a string, got number"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validate([]byte(tt.data), s)
+			if tt.want == nil {
+				assert.NoError(t, err)
+				return
+			}
+			var validationErr *ValidationError
+			if assert.True(t, errors.As(err, &validationErr), "error = %v", err) {
+				assert.Equal(t, tt.want, validationErr.Violations)
+			}
+		})
+	}
+
+	assert.Error(t, validate([]byte(`{"id":`), s))
+}
+
+func TestDoValidationRetry(t *testing.T) {
+	type Review struct {
+		Score int `json:"score" min:"1" max:"10"`
+	}
+
+	c := &client{
+		llm: &mockLLM{
+			responses: [][]byte{[]byte(`{"score":11}`), []byte(`{"score":9}`)},
+			errors:    []error{nil, nil},
+		},
+		retry: 1,
+	}
+	got, err := Get[Review](context.Background(), c, []string{})
+	assert.NoError(t, err)
+	assert.Equal(t, 9, got.Score)
+
+	c = &client{llm: &mockLLM{
+		responses: [][]byte{[]byte(`{"score":0}`)},
+		errors:    []error{nil},
+	}}
+	_, err = Get[Review](context.Background(), c, []string{})
+	var decodeErr *DecodeError
+	assert.True(t, errors.As(err, &decodeErr))
+	assert.EqualError(t, decodeErr.Err, "$.score: must be at least 1, got 0")
+}
+
+type draft struct {
+	A string         `json:"a"`
+	B string         `json:"b,omitempty"`
+	M map[string]int `json:"m"`
+}
+
+func (d draft) Validate() error {
+	if d.A != "good" {
+		return errors.New("a is not good")
+	}
+	return nil
+}
+
+func TestDoValidatorRetryFreshResult(t *testing.T) {
+	c := &client{llm: &mockLLM{
+		responses: [][]byte{[]byte(`{"a":"bad","b":"leak","m":{"x":1}}`), []byte(`{"a":"good","m":{"y":2}}`)},
+		errors:    []error{nil, nil},
+	}, repair: 1}
+
+	got, err := Get[draft](context.Background(), c, []string{})
+	assert.NoError(t, err)
+	assert.Equal(t, draft{A: "good", M: map[string]int{"y": 2}}, got)
+}
+
+func TestDoNullableElements(t *testing.T) {
+	c := &client{llm: &mockLLM{
+		responses: [][]byte{[]byte(`{"values":[1,null]}`)},
+		errors:    []error{nil},
+	}}
+	list, err := Get[[]*int](context.Background(), c, []string{})
+	if assert.NoError(t, err) && assert.Len(t, list, 2) {
+		assert.Equal(t, 1, *list[0])
+		assert.Nil(t, list[1])
+	}
+
+	// Map values are nullable in key/value pairs too
+	c = &client{llm: &mockLLM{
+		responses: [][]byte{[]byte(`{"values":[{"key":"a","value":null}]}`)},
+		errors:    []error{nil},
+	}, structuredOutput: true}
+	byName, err := Get[map[string]*int](context.Background(), c, []string{})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]*int{"a": nil}, byName)
+}
+
+type period struct {
+	Start Date `json:"start"`
+	End   Date `json:"end"`
+}
+
+func (p *period) Validate() error {
+	if p.End.In(time.UTC).Before(p.Start.In(time.UTC)) {
+		return errors.New("end is before start")
+	}
+	return nil
+}
+
+type trip struct {
+	Stops  []period           `json:"stops"`
+	ByCity map[string]*period `json:"by_city"`
+	Total  int                `json:"total"`
+}
+
+func (t trip) Validate() error {
+	if t.Total != len(t.Stops) {
+		return errors.Errorf("total is %d, but there are %d stops", t.Total, len(t.Stops))
+	}
+	return nil
+}
+
+func TestValidateResult(t *testing.T) {
+	day := func(d int) Date {
+		return Date{Year: 2025, Month: time.March, Day: d}
+	}
+	ret := &trip{
+		Stops:  []period{{Start: day(1), End: day(2)}, {Start: day(3), End: day(2)}},
+		ByCity: map[string]*period{"paris": {Start: day(5), End: day(4)}, "rome": nil},
+		Total:  3,
+	}
+
+	err := validateResult(reflect.ValueOf(ret), "$", nil)
+	var validationErr *ValidationError
+	if assert.True(t, errors.As(err, &validationErr)) {
+		assert.Equal(t, []Violation{
+			{Path: "$.stops[1]", Message: "end is before start"},
+			{Path: "$.by_city.paris", Message: "end is before start"},
+			{Path: "$", Message: "total is 3, but there are 2 stops"},
+		}, validationErr.Violations)
+	}
+
+	valid := &trip{Stops: []period{{Start: day(1), End: day(2)}}, Total: 1}
+	assert.NoError(t, validateResult(reflect.ValueOf(valid), "$", nil))
+	err = validateResult(reflect.ValueOf(valid), "$.value", func(ret any) error {
+		assert.Same(t, valid, ret)
+		return errors.New("rejected")
+	})
+	assert.EqualError(t, err, "$.value: rejected")
+
+	// Only struct results are passed to the validate function
+	list := []period{{Start: day(1), End: day(2)}}
+	assert.NoError(t, validateResult(reflect.ValueOf(&list), "$.values", func(ret any) error {
+		return errors.New("rejected")
+	}))
+}
+
+func TestDoValidatorRepair(t *testing.T) {
+	mockLLM := &mockLLM{
+		responses: [][]byte{
+			[]byte(`{"values":[{"start":"2025-03-02","end":"2025-03-01"}]}`),
+			[]byte(`{"values":[{"start":"2025-03-01","end":"2025-03-02"}]}`),
+		},
+		errors: []error{nil, nil},
+	}
+	c := &client{llm: mockLLM, repair: 1}
+
+	got, err := Get[[]period](context.Background(), c, []string{"plan"})
+	assert.NoError(t, err)
+	assert.Equal(t, []period{{Start: Date{Year: 2025, Month: time.March, Day: 1}, End: Date{Year: 2025, Month: time.March, Day: 2}}}, got)
+	assert.Contains(t, mockLLM.lastMessages[2].Content, "$.values[0]: end is before start")
+}